@@ -0,0 +1,75 @@
+package detector
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPriorityAnchor(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for _, p := range []string{"deploy", "conf", "conf/deploy"} {
+		os.MkdirAll(filepath.Join(dir, p), 0755)
+	}
+	ioutil.WriteFile(filepath.Join(dir, "deploy", "db.yaml"), nil, 0644)
+	ioutil.WriteFile(filepath.Join(dir, "conf", "deploy", "db.yaml"), nil, 0644)
+	ioutil.WriteFile(filepath.Join(dir, "conf", "db.yaml"), nil, 0644)
+
+	type layout struct {
+		Conf struct {
+			DBYaml    string `pd:"Priority(deploy)"`
+			ParentDB  string `pd:"Name(db.yaml);Priority(./deploy);Anchor(parent)"`
+			BaseDB    string `pd:"Name(db.yaml);Priority(deploy);Anchor(base)"`
+			DefaultDB string `pd:"Name(db.yaml)"`
+		}
+	}
+	var v layout
+	if err := NewDetector().WithLenient().WithDir(dir).Detect(&v); err != nil {
+		t.Fatal(err)
+	}
+	if v.Conf.DBYaml != filepath.Join(dir, "deploy", "db.yaml") || v.Conf.BaseDB != v.Conf.DBYaml {
+		t.Error("默认应该相对于工作目录：", v.Conf.DBYaml, v.Conf.BaseDB)
+	}
+	if v.Conf.ParentDB != filepath.Join(dir, "conf", "deploy", "db.yaml") {
+		t.Error("Anchor(parent)应该相对于父目录：", v.Conf.ParentDB)
+	}
+
+	v = layout{}
+	if err := NewDetector().WithLenient().WithPriorityAnchor(Anchor.ParentDir).WithDir(dir).Detect(&v); err != nil {
+		t.Fatal(err)
+	}
+	if v.Conf.DBYaml != filepath.Join(dir, "conf", "deploy", "db.yaml") || v.Conf.BaseDB != filepath.Join(dir, "deploy", "db.yaml") {
+		t.Error("WithPriorityAnchor应该修改默认的起点：", v.Conf.DBYaml, v.Conf.BaseDB)
+	}
+}
+
+func TestRelativeEnvAndBaseDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	os.MkdirAll(filepath.Join(dir, "deploy"), 0755)
+	ioutil.WriteFile(filepath.Join(dir, "deploy", "db.yaml"), nil, 0644)
+	wd, _ := os.Getwd()
+	defer os.Chdir(wd)
+	os.Chdir(filepath.Dir(dir))
+
+	os.Setenv("PD_RELATIVE_DB", "./deploy/../deploy/db.yaml")
+	defer os.Unsetenv("PD_RELATIVE_DB")
+	var v struct {
+		Path   string
+		DBYaml string `pd:"Key(PD_RELATIVE_DB)"`
+	}
+	if err := NewDetector().WithDir(filepath.Base(dir)).Detect(&v); err != nil {
+		t.Fatal(err)
+	}
+	if v.Path != dir || v.DBYaml != filepath.Join(dir, "deploy", "db.yaml") {
+		t.Error("探测结果应该是清理后的绝对路径：", v.Path, v.DBYaml)
+	}
+}
@@ -0,0 +1,72 @@
+package detector
+
+import (
+	"path/filepath"
+)
+
+// 会传递给子孙成员的tag，也是WithDefaultTag中仅能使用的tag
+var cascadeTagNames = []string{"FileExt", "FileSplit", "ChildPriority"}
+
+// 解析WithDefaultTag设置的tag，只能使用会传递给子孙成员的tag
+func parseDefaultTag(s string) (envTag, error) {
+	et, err := parseTagOnly(s, cascadeTagNames)
+	if err != nil {
+		err.(*TagError).Field = "WithDefaultTag"
+	}
+	return et, err
+}
+
+// 只对目录有效的tag，返回第一个设置了的tag名，没有则为空
+func cascadeTagName(et envTag) string {
+	switch {
+	case et.FileExt != "":
+		return "FileExt"
+	case et.FileSplit != "":
+		return "FileSplit"
+	case len(et.ChildPriority) > 0:
+		return "ChildPriority"
+	}
+	return ""
+}
+
+// 子孙文件的默认后缀，使用最近的设置了FileExt的上级目录，根目录的为WithDefaultTag的配置
+func (this *dirSchema) fileExt() string {
+	for dir := this; dir != nil; dir = dir.ParentDir {
+		if dir.fieldTag.FileExt != "" {
+			return dir.fieldTag.FileExt
+		}
+	}
+	return ""
+}
+
+// 子孙文件的默认分隔符，规则同fileExt
+func (this *dirSchema) fileSplit() string {
+	for dir := this; dir != nil; dir = dir.ParentDir {
+		if dir.fieldTag.FileSplit != "" {
+			return dir.fieldTag.FileSplit
+		}
+	}
+	return ""
+}
+
+// 当前目录的优先路径：父目录的ChildPriority（拼接当前目录名）在前，自身的Priority在后
+func (this *dirSchema) priority() []string {
+	if this.ParentDir == nil || len(this.ParentDir.fieldTag.ChildPriority) == 0 {
+		return this.fieldTag.Priority
+	}
+	res := make([]string, 0, len(this.ParentDir.fieldTag.ChildPriority)+len(this.fieldTag.Priority))
+	for _, base := range this.ParentDir.fieldTag.ChildPriority {
+		res = append(res, filepath.Join(base, this.Name))
+	}
+	return append(res, this.fieldTag.Priority...)
+}
+
+// 当前文件的优先目录：父目录的ChildPriority在前，自身的Priority在后
+func (this *fileSchema) priority() []string {
+	if this.ParentDir == nil || len(this.ParentDir.fieldTag.ChildPriority) == 0 {
+		return this.fieldTag.Priority
+	}
+	res := make([]string, 0, len(this.ParentDir.fieldTag.ChildPriority)+len(this.fieldTag.Priority))
+	res = append(res, this.ParentDir.fieldTag.ChildPriority...)
+	return append(res, this.fieldTag.Priority...)
+}
@@ -0,0 +1,85 @@
+package detector
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCascadeTags(t *testing.T) {
+	type layout struct {
+		Conf struct {
+			DBConfig string
+			AppLog   string `pd:"Ext(log);Split(_)"`
+			Sub      struct {
+				RedisConf string
+			} `pd:"FileExt(toml)"`
+		} `pd:"FileExt(yaml);FileSplit(-)"`
+		Other struct {
+			DBConfig string
+		}
+	}
+	sch, err := NewDetector().WithDefaultTag("FileExt(json)").Compile(reflect.TypeOf(layout{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := make([]string, 0)
+	for _, n := range sch.nodes {
+		if !n.isDir {
+			names = append(names, n.namePath)
+		}
+	}
+	exp := []string{"conf/db-config.yaml", "conf/app_log.log", "conf/sub/redis-conf.toml", "other/db.config.json"}
+	if !reflect.DeepEqual(names, exp) {
+		t.Errorf("%v != %v", names, exp)
+	}
+
+	if _, err := NewDetector().WithDefaultTag("Opt").Compile(reflect.TypeOf(layout{})); err == nil || !strings.Contains(err.Error(), "不能使用Opt") {
+		t.Error("WithDefaultTag中不能使用非传递的tag：", err)
+	}
+	for _, tag := range []string{"Wait(3s)", "IgnoreCase", "Symlink(resolve)", "Contained", "FileExt(json);Wait(3s)"} {
+		if _, err := parseDefaultTag(tag); err == nil || !strings.Contains(err.Error(), "只能使用FileExt、FileSplit、ChildPriority") {
+			t.Errorf("WithDefaultTag中不能使用%s：%v", tag, err)
+		}
+	}
+	_, err = NewDetector().Compile(reflect.TypeOf(struct {
+		DBConfig string `pd:"FileExt(yaml)"`
+	}{}))
+	if err == nil || !strings.Contains(err.Error(), "FileExt仅对目录有效") {
+		t.Error("文件不能使用FileExt：", err)
+	}
+}
+
+func TestChildPriority(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for _, p := range []string{"run/conf/sub", "conf/sub"} {
+		os.MkdirAll(filepath.Join(dir, p), 0755)
+	}
+	ioutil.WriteFile(filepath.Join(dir, "run", "conf", "db.yaml"), nil, 0644)
+	ioutil.WriteFile(filepath.Join(dir, "conf", "db.yaml"), nil, 0644)
+
+	var v struct {
+		Conf struct {
+			DBYaml string
+			Sub    struct {
+				Path string
+			}
+		} `pd:"ChildPriority(run/conf)"`
+	}
+	if err := NewDetector().WithDir(dir).Detect(&v); err != nil {
+		t.Fatal(err)
+	}
+	if v.Conf.DBYaml != filepath.Join(dir, "run", "conf", "db.yaml") {
+		t.Error("ChildPriority应该对子文件生效：", v.Conf.DBYaml)
+	}
+	if v.Conf.Sub.Path != filepath.Join(dir, "run", "conf", "sub") {
+		t.Error("ChildPriority应该对子目录生效：", v.Conf.Sub.Path)
+	}
+}
@@ -0,0 +1,40 @@
+// pdcodegen为结构体生成免反射的探测函数，一般配合go generate使用：
+//
+//	//go:generate go run github.com/szyhf/go-path-detector/cmd/pdcodegen -type Work
+//
+// 会在当前目录生成work_detector.go，其中包含`func DetectWork(det detector.Detector) (Work, error)`。
+package main
+
+import (
+	"flag"
+	"io/ioutil"
+	"log"
+	"strings"
+
+	"github.com/szyhf/go-path-detector"
+)
+
+func main() {
+	typeNames := flag.String("type", "", "需要生成探测函数的结构体，多个用`,`分隔")
+	dir := flag.String("dir", ".", "结构体所在的包目录")
+	output := flag.String("o", "", "输出文件，默认为<第一个结构体名的小写>_detector.go")
+	ignoreUnsupported := flag.Bool("ignore-unsupported", false, "忽略不支持的成员，与Detector.WithIgnoreUnsupported()一致")
+	flag.Parse()
+
+	if *typeNames == "" {
+		log.Fatal("必须通过-type指定结构体")
+	}
+	types := strings.Split(*typeNames, ",")
+	src, err := detector.GenerateDetectFunc(*dir, detector.CodegenOptions{
+		IgnoreUnsupported: *ignoreUnsupported,
+	}, types...)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if *output == "" {
+		*output = strings.ToLower(types[0]) + "_detector.go"
+	}
+	if err = ioutil.WriteFile(*output, src, 0644); err != nil {
+		log.Fatal(err)
+	}
+}
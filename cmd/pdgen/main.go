@@ -0,0 +1,40 @@
+// pdgen根据已有的目录树生成对应的结构体，生成的结构体可以直接用于detector.Detect。
+//
+//	pdgen -dir ./test -type Work -pkg main -o work_layout.go
+package main
+
+import (
+	"flag"
+	"io/ioutil"
+	"log"
+	"os"
+
+	"github.com/szyhf/go-path-detector"
+)
+
+func main() {
+	dir := flag.String("dir", ".", "需要扫描的目录")
+	typeName := flag.String("type", "Layout", "生成的结构体名")
+	pkg := flag.String("pkg", "main", "生成代码的包名")
+	split := flag.String("split", ".", "文件名分隔符，与Detector.WithFileSplit保持一致")
+	hidden := flag.Bool("hidden", false, "是否包含以.开头的文件/目录")
+	output := flag.String("o", "", "输出文件，默认输出到stdout")
+	flag.Parse()
+
+	src, err := detector.NewGenerator().
+		WithPackage(*pkg).
+		WithTypeName(*typeName).
+		WithFileSplit(*split).
+		WithHidden(*hidden).
+		Generate(*dir)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if *output == "" {
+		os.Stdout.Write(src)
+		return
+	}
+	if err = ioutil.WriteFile(*output, src, 0644); err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,293 @@
+package detector
+
+import (
+	"fmt"
+	"go/ast"
+	"go/build"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// 生成探测函数时的配置
+type CodegenOptions struct {
+	// 忽略不支持的成员，与Detector.WithIgnoreUnsupported()一致
+	IgnoreUnsupported bool
+}
+
+// 根据目录dir中的Go源码，为typeNames对应的结构体生成免反射的探测函数`DetectXxx`。
+// 生成时会按默认的配置编译布局，tag非法、引用不存在的成员、循环引用等错误直接返回，而不是等到运行时。
+// 只支持同一个包内定义的类型。
+func GenerateDetectFunc(dir string, opts CodegenOptions, typeNames ...string) ([]byte, error) {
+	if len(typeNames) == 0 {
+		return nil, fmt.Errorf("至少需要指定一个结构体")
+	}
+	pkg, err := build.ImportDir(dir, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	// 收集包内所有的类型定义
+	fset := token.NewFileSet()
+	types := make(map[string]ast.Expr)
+	for _, name := range pkg.GoFiles {
+		file, err := parser.ParseFile(fset, filepath.Join(dir, name), nil, 0)
+		if err != nil {
+			return nil, err
+		}
+		for _, decl := range file.Decls {
+			genDecl, ok := decl.(*ast.GenDecl)
+			if !ok || genDecl.Tok != token.TYPE {
+				continue
+			}
+			for _, s := range genDecl.Specs {
+				typeSpec := s.(*ast.TypeSpec)
+				types[typeSpec.Name.Name] = typeSpec.Type
+			}
+		}
+	}
+
+	g := &codeGenerator{types: types, opts: opts}
+	buf := &strings.Builder{}
+	fmt.Fprintf(buf, "// Code generated by pdcodegen. DO NOT EDIT.\n\n")
+	fmt.Fprintf(buf, "package %s\n\n", pkg.Name)
+	fmt.Fprintf(buf, "import detector %q\n", "github.com/szyhf/go-path-detector")
+	for _, typeName := range typeNames {
+		expr, ok := types[typeName]
+		if !ok {
+			return nil, fmt.Errorf("找不到结构体%s", typeName)
+		}
+		if _, ok := expr.(*ast.StructType); !ok {
+			return nil, fmt.Errorf("%s不是Struct", typeName)
+		}
+		spec, err := g.newSpec(expr, "", "", typeName)
+		if err != nil {
+			return nil, err
+		}
+		if err = g.compile(spec); err != nil {
+			return nil, fmt.Errorf("%s：%w", typeName, err)
+		}
+		g.writeFunc(buf, typeName, spec)
+	}
+
+	src, err := format.Source([]byte(buf.String()))
+	if err != nil {
+		return nil, fmt.Errorf("格式化生成的代码失败：%s", err.Error())
+	}
+	return src, nil
+}
+
+type codeGenerator struct {
+	types map[string]ast.Expr
+	opts  CodegenOptions
+}
+
+// 与反射时的newSpec保持一致，被忽略的成员返回nil
+func (this *codeGenerator) newSpec(expr ast.Expr, field, tag, fieldPath string) (*Spec, error) {
+	switch t := expr.(type) {
+	case *ast.Ident:
+		if t.Name == "string" {
+			return &Spec{Field: field, Tag: tag}, nil
+		}
+		underlying, ok := this.types[t.Name]
+		if !ok {
+			return this.unsupported(fieldPath, t.Name)
+		}
+		spec, err := this.newSpec(underlying, field, tag, fieldPath)
+		if spec != nil && !spec.Dir {
+			// 以string、[]string为底层类型的自定义类型，生成的代码中需要转换指针
+			spec.convert = true
+		}
+		return spec, err
+	case *ast.ArrayType:
+		if elt, ok := t.Elt.(*ast.Ident); ok && t.Len == nil && elt.Name == "string" {
+			return &Spec{Field: field, Tag: tag, List: true}, nil
+		}
+		return this.unsupported(fieldPath, "")
+	case *ast.StructType:
+		spec := &Spec{
+			Field: field,
+			Tag:   tag,
+			Dir:   true,
+		}
+		children, numFields, err := this.newChildSpecs(t, fieldPath, "", 0)
+		if err != nil {
+			return nil, err
+		}
+		if spec.Children, err = flattenSpecs(children, fieldPath); err != nil {
+			return nil, err
+		}
+		if field != "" && this.opts.IgnoreUnsupported && len(spec.Children) == 0 && numFields > 0 {
+			// 没有任何可用成员，不看做目录
+			return nil, nil
+		}
+		return spec, nil
+	default:
+		return this.unsupported(fieldPath, "")
+	}
+}
+
+// 与反射时的newChildSpecs保持一致，selector为展开的匿名成员的选择器前缀
+func (this *codeGenerator) newChildSpecs(t *ast.StructType, fieldPath, selector string, depth int) ([]*Spec, int, error) {
+	children := make([]*Spec, 0, len(t.Fields.List))
+	numFields := 0
+	for _, f := range t.Fields.List {
+		childTag := ""
+		if f.Tag != nil {
+			s, err := strconv.Unquote(f.Tag.Value)
+			if err != nil {
+				return nil, 0, err
+			}
+			childTag = reflect.StructTag(s).Get("pd")
+		}
+		names := make([]string, 0, len(f.Names))
+		for _, name := range f.Names {
+			names = append(names, name.Name)
+		}
+		if len(names) == 0 {
+			if childTag == "-" {
+				numFields++
+				continue
+			}
+			// 匿名成员以类型名作为字段名
+			ident, ok := f.Type.(*ast.Ident)
+			if !ok {
+				// 其他包的类型（如sync.Mutex）或者指针，生成时无法展开，与反射时一样可以忽略
+				numFields++
+				if this.opts.IgnoreUnsupported {
+					continue
+				}
+				return nil, 0, fmt.Errorf("匿名成员%s.%s不支持其他包的类型或者指针，可以通过`pd:\"-\"`忽略", fieldPath, embeddedName(f.Type))
+			}
+			childPath := fieldPath + "." + ident.Name
+			if embedded, ok := this.types[ident.Name].(*ast.StructType); ok {
+				flatten, err := isFlattenTag(childTag, childPath)
+				if err != nil {
+					return nil, 0, err
+				}
+				if flatten {
+					// 与encoding/json一致，即使匿名成员的类型未导出，其导出的成员仍然可用
+					embeddedChildren, n, err := this.newChildSpecs(embedded, fieldPath, selector+ident.Name+".", depth+1)
+					if err != nil {
+						return nil, 0, err
+					}
+					children = append(children, embeddedChildren...)
+					numFields += n + 1
+					continue
+				}
+			}
+			names = append(names, ident.Name)
+		}
+		for _, name := range names {
+			numFields++
+			childPath := fieldPath + "." + name
+			if childTag == "-" {
+				continue
+			}
+			if !ast.IsExported(name) {
+				if this.opts.IgnoreUnsupported {
+					continue
+				}
+				return nil, 0, fmt.Errorf("成员%s未导出，无法写入路径，可以通过`pd:\"-\"`忽略", childPath)
+			}
+			if err := validateTag(childTag); err != nil {
+				err.(*TagError).Field = childPath
+				return nil, 0, err
+			}
+			childSpec, err := this.newSpec(f.Type, name, childTag, childPath)
+			if err != nil {
+				return nil, 0, err
+			}
+			if childSpec != nil {
+				childSpec.selector, childSpec.depth = selector+name, depth
+				children = append(children, childSpec)
+			}
+		}
+	}
+	return children, numFields, nil
+}
+
+// 与运行时使用同一套编译逻辑，只是不写入缓存
+func (this *codeGenerator) compile(spec *Spec) error {
+	_, err := NewDetector().(*detector).schemaOptions.compile(spec)
+	return err
+}
+
+// 匿名成员的字段名，即去掉包名及指针的类型名
+func embeddedName(expr ast.Expr) string {
+	switch t := expr.(type) {
+	case *ast.StarExpr:
+		return embeddedName(t.X)
+	case *ast.SelectorExpr:
+		return t.Sel.Name
+	case *ast.Ident:
+		return t.Name
+	}
+	return ""
+}
+
+func (this *codeGenerator) unsupported(fieldPath, typeName string) (*Spec, error) {
+	if this.opts.IgnoreUnsupported {
+		return nil, nil
+	}
+	return nil, fmt.Errorf("成员%s不支持的数据类型%s，可以通过`pd:\"-\"`忽略", fieldPath, typeName)
+}
+
+func (this *codeGenerator) writeFunc(buf *strings.Builder, typeName string, spec *Spec) {
+	specName := strings.ToLower(typeName[:1]) + typeName[1:] + "Spec"
+	fmt.Fprintf(buf, "\nvar %s = ", specName)
+	buf.WriteString("&detector.Spec")
+	this.writeSpec(buf, spec)
+	buf.WriteString("\n")
+
+	fmt.Fprintf(buf, "\n// Detect%s 按%s的布局探测路径，与det.Detect(&v)的结果一致，但不使用反射。\n", typeName, typeName)
+	fmt.Fprintf(buf, "func Detect%s(det detector.Detector) (%s, error) {\n", typeName, typeName)
+	fmt.Fprintf(buf, "var v %s\n", typeName)
+	fmt.Fprintf(buf, "err := det.DetectSpec(%s, []interface{}{\n", specName)
+	this.writeTargets(buf, spec, "v")
+	buf.WriteString("})\n")
+	buf.WriteString("return v, err\n")
+	buf.WriteString("}\n")
+}
+
+func (this *codeGenerator) writeSpec(buf *strings.Builder, spec *Spec) {
+	buf.WriteString("{")
+	if spec.Field != "" {
+		fmt.Fprintf(buf, "Field: %q, ", spec.Field)
+	}
+	if spec.Tag != "" {
+		fmt.Fprintf(buf, "Tag: %q, ", spec.Tag)
+	}
+	if spec.List {
+		buf.WriteString("List: true, ")
+	}
+	if spec.Dir {
+		buf.WriteString("Dir: true, Children: []*detector.Spec{\n")
+		for _, child := range spec.Children {
+			this.writeSpec(buf, child)
+			buf.WriteString(",\n")
+		}
+		buf.WriteString("},")
+	}
+	buf.WriteString("}")
+}
+
+// 与反射时specTargetIndex的顺序保持一致
+func (this *codeGenerator) writeTargets(buf *strings.Builder, spec *Spec, prefix string) {
+	for _, child := range spec.Children {
+		switch {
+		case child.Dir:
+			this.writeTargets(buf, child, prefix+"."+child.selector)
+		case child.convert && child.List:
+			fmt.Fprintf(buf, "(*[]string)(&%s.%s),\n", prefix, child.selector)
+		case child.convert:
+			fmt.Fprintf(buf, "(*string)(&%s.%s),\n", prefix, child.selector)
+		default:
+			fmt.Fprintf(buf, "&%s.%s,\n", prefix, child.selector)
+		}
+	}
+}
@@ -0,0 +1,196 @@
+package detector
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestGenerateDetectFunc(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pdcodegen")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	src := "package layout\n\n" +
+		"type Conf struct {\n\tDitFile string `pd:\"Ext(txt);Split(-);\"`\n\tsecret string\n\tMeta int\n}\n\n" +
+		"type Work struct {\n\tPath string\n\tConf Conf `pd:\"Key(CONF_DIR);\"`\n\tPlugins []string\n}\n\n" +
+		"type Composite struct {\n\tWork\n}\n\n" +
+		"type Bad struct {\n\tFile string `pd:\"Unknown(x)\"`\n}\n\n" +
+		"type BadRef struct {\n\tFile string `pd:\"Priority(${Missing.Path})\"`\n}\n\n" +
+		"type MyPath string\n\ntype MyPaths []string\n\n" +
+		"type Named struct {\n\tDBYaml MyPath\n\tPlugins MyPaths\n}\n"
+	if err = ioutil.WriteFile(filepath.Join(dir, "layout.go"), []byte(src), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	code, err := GenerateDetectFunc(dir, CodegenOptions{IgnoreUnsupported: true}, "Work")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, exp := range []string{
+		"package layout",
+		"func DetectWork(det detector.Detector) (Work, error)",
+		`{Field: "Conf", Tag: "Key(CONF_DIR);", Dir: true`,
+		"&v.Conf.DitFile,",
+		`{Field: "Plugins", List: true}`,
+		"&v.Plugins,",
+	} {
+		if !strings.Contains(string(code), exp) {
+			t.Errorf("缺少`%s`：\n%s", exp, code)
+		}
+	}
+
+	if strings.Contains(string(code), "secret") || strings.Contains(string(code), "Meta") {
+		t.Error("不支持的成员应该被忽略：\n", string(code))
+	}
+	code, err = GenerateDetectFunc(dir, CodegenOptions{IgnoreUnsupported: true}, "Composite")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(code), "&v.Work.Conf.DitFile,") || strings.Contains(string(code), `Field: "Work"`) {
+		t.Error("匿名成员应该被展开：\n", string(code))
+	}
+
+	if _, err = GenerateDetectFunc(dir, CodegenOptions{}, "Work"); err == nil {
+		t.Error("默认不应该忽略不支持的成员")
+	}
+
+	if _, err = GenerateDetectFunc(dir, CodegenOptions{}, "Bad"); err == nil || !strings.Contains(err.Error(), "Bad.File") {
+		t.Error("非法的tag应该在生成时报错：", err)
+	}
+	if _, err = GenerateDetectFunc(dir, CodegenOptions{}, "BadRef"); err == nil || !strings.Contains(err.Error(), "Missing") {
+		t.Error("引用不存在的成员应该在生成时报错：", err)
+	}
+
+	code, err = GenerateDetectFunc(dir, CodegenOptions{}, "Named")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(code), "(*string)(&v.DBYaml),") || !strings.Contains(string(code), "(*[]string)(&v.Plugins),") {
+		t.Error("自定义的string类型应该转换指针：\n", string(code))
+	}
+}
+
+type codegenPath string
+
+type codegenMeta struct {
+	Version int
+}
+
+type codegenBase struct {
+	Conf struct {
+		DBYaml codegenPath
+	}
+}
+
+type codegenLayout struct {
+	sync.Mutex   `pd:"-"`
+	*codegenMeta `pd:"-"`
+	codegenBase
+	Var struct {
+		Log struct {
+			AppLog string `pd:"Name(app.log)"`
+		}
+	} `pd:"Priority(${Conf}/../var)"`
+	Plugins []string `pd:"Opt"`
+}
+
+const codegenLayoutSrc = "package layout\n\nimport \"sync\"\n\n" +
+	"type codegenPath string\n\n" +
+	"type codegenMeta struct {\n\tVersion int\n}\n\n" +
+	"type codegenBase struct {\n\tConf struct {\n\t\tDBYaml codegenPath\n\t}\n}\n\n" +
+	"type codegenLayout struct {\n\tsync.Mutex `pd:\"-\"`\n\t*codegenMeta `pd:\"-\"`\n\tcodegenBase\n" +
+	"\tVar struct {\n\t\tLog struct {\n\t\t\tAppLog string `pd:\"Name(app.log)\"`\n\t\t}\n\t} `pd:\"Priority(${Conf}/../var)\"`\n" +
+	"\tPlugins []string `pd:\"Opt\"`\n}\n"
+
+// 按生成代码中的选择器取得成员的指针，与writeTargets一致
+func codegenTargets(spec *Spec, v reflect.Value, res []interface{}) []interface{} {
+	for _, child := range spec.Children {
+		field := v
+		for _, name := range strings.Split(child.selector, ".") {
+			field = field.FieldByName(name)
+		}
+		switch {
+		case child.Dir:
+			res = codegenTargets(child, field, res)
+		case child.List:
+			res = append(res, field.Addr().Convert(stringSlicePtrType).Interface())
+		default:
+			res = append(res, field.Addr().Convert(stringPtrType).Interface())
+		}
+	}
+	return res
+}
+
+func TestGeneratedDetectSpec(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pdcodegen")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err = ioutil.WriteFile(filepath.Join(dir, "layout.go"), []byte(codegenLayoutSrc), 0644); err != nil {
+		t.Fatal(err)
+	}
+	code, err := GenerateDetectFunc(dir, CodegenOptions{}, "codegenLayout")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(code), "(*string)(&v.codegenBase.Conf.DBYaml),") {
+		t.Error("匿名成员应该被展开：\n", string(code))
+	}
+
+	work := filepath.Join(dir, "work")
+	os.MkdirAll(filepath.Join(work, "conf"), 0755)
+	os.MkdirAll(filepath.Join(work, "var", "log"), 0755)
+	ioutil.WriteFile(filepath.Join(work, "conf", "db.yaml"), nil, 0644)
+	ioutil.WriteFile(filepath.Join(work, "var", "log", "app.log"), nil, 0644)
+
+	// 生成的Spec与反射的结果一致
+	file, err := parser.ParseFile(token.NewFileSet(), "layout.go", codegenLayoutSrc, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	types := make(map[string]ast.Expr)
+	for _, decl := range file.Decls {
+		if genDecl, ok := decl.(*ast.GenDecl); ok && genDecl.Tok == token.TYPE {
+			typeSpec := genDecl.Specs[0].(*ast.TypeSpec)
+			types[typeSpec.Name.Name] = typeSpec.Type
+		}
+	}
+	g := &codeGenerator{types: types}
+	spec, err := g.newSpec(types["codegenLayout"], "", "", "codegenLayout")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var generated codegenLayout
+	if err := NewDetector().WithDir(work).DetectSpec(spec, codegenTargets(spec, reflect.ValueOf(&generated).Elem(), nil)); err != nil {
+		t.Fatal(err)
+	}
+	var reflected codegenLayout
+	if err := NewDetector().WithDir(work).Detect(&reflected); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(&generated, &reflected) {
+		t.Errorf("DetectSpec与Detect的结果不一致：\n%+v\n%+v", &generated, &reflected)
+	}
+	if reflected.Var.Log.AppLog != filepath.Join(work, "var", "log", "app.log") || string(reflected.Conf.DBYaml) != filepath.Join(work, "conf", "db.yaml") {
+		t.Errorf("预料之外的结果：%+v", &reflected)
+	}
+
+	// 其他包的匿名成员在忽略不支持的成员时同样被忽略
+	ioutil.WriteFile(filepath.Join(dir, "layout.go"), []byte(strings.Replace(codegenLayoutSrc, "sync.Mutex `pd:\"-\"`", "sync.Mutex", 1)), 0644)
+	if _, err := GenerateDetectFunc(dir, CodegenOptions{}, "codegenLayout"); err == nil || !strings.Contains(err.Error(), "Mutex") {
+		t.Error("默认不应该忽略其他包的匿名成员：", err)
+	}
+	if _, err := GenerateDetectFunc(dir, CodegenOptions{IgnoreUnsupported: true}, "codegenLayout"); err != nil {
+		t.Error(err)
+	}
+}
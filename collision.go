@@ -0,0 +1,218 @@
+package detector
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+)
+
+var CollisionKind = struct {
+	// 多个成员使用了同一个环境变量名
+	EnvKey string
+	// 多个成员探测到了同一个路径
+	Path string
+}{
+	EnvKey: "env",
+	Path:   "path",
+}
+
+// 成员之间的冲突
+type Collision struct {
+	// 冲突类型，见CollisionKind
+	Kind string
+	// 冲突的环境变量名或者路径
+	Value string
+	// 冲突的成员，形如`Conf.DBConfig`，Registry中形如`search:Runtimes.Search`
+	Fields []string
+}
+
+func (this Collision) String() string {
+	switch this.Kind {
+	case CollisionKind.EnvKey:
+		return fmt.Sprintf("成员%s使用了同一个环境变量'%s'", strings.Join(this.Fields, "、"), this.Value)
+	default:
+		return fmt.Sprintf("成员%s指向了同一个路径'%s'", strings.Join(this.Fields, "、"), this.Value)
+	}
+}
+
+// 存在冲突时返回的错误
+type CollisionError struct {
+	Collisions []Collision
+}
+
+func (this *CollisionError) Error() string {
+	sl := make([]string, 0, len(this.Collisions))
+	for _, c := range this.Collisions {
+		sl = append(sl, c.String())
+	}
+	return "存在冲突：" + strings.Join(sl, "；")
+}
+
+// Schema中的一个目录或者文件
+type schemaNode struct {
+	// 成员路径，形如`Conf.DBConfig`
+	fieldPath string
+	// 相对于根目录的名称路径，形如`conf/db.config`
+	namePath string
+	envKey   string
+	// 包括envKey在内的所有环境变量名
+	envKeys []string
+	isDir   bool
+	// 探测结果的下标，-1表示没有
+	targetIdx int
+}
+
+// 按定义顺序列出Schema中除根目录以外的所有目录和文件
+func (this *Schema) walkNodes() []schemaNode {
+	res := make([]schemaNode, 0, this.numTargets)
+	var walk func(dir *dirSchema, namePath string)
+	walk = func(dir *dirSchema, namePath string) {
+		for _, fileSch := range dir.ChildrenFile {
+			res = append(res, schemaNode{
+				fieldPath: joinFieldPath(dir.fieldPath(), fileSch.fieldName),
+				namePath:  path.Join(namePath, fileSch.Name),
+				envKey:    fileSch.EnvPathKey,
+				envKeys:   fileSch.envKeys.keys,
+				targetIdx: fileSch.targetIdx,
+			})
+		}
+		for _, dirSch := range dir.ChildrenDir {
+			childPath := path.Join(namePath, dirSch.Name)
+			res = append(res, schemaNode{
+				fieldPath: dirSch.fieldPath(),
+				namePath:  childPath,
+				envKey:    dirSch.EnvPathKey,
+				envKeys:   dirSch.envKeys.keys,
+				isDir:     true,
+				targetIdx: dirSch.pathTargetIdx,
+			})
+			walk(dirSch, childPath)
+		}
+	}
+	walk(this.root, "")
+	return res
+}
+
+// 待检查冲突的成员
+type collisionNode struct {
+	schemaNode
+	// 所属的布局片段，见Registry
+	owner string
+	// 探测到的路径，未探测时为空
+	resolved string
+}
+
+func (this collisionNode) label() string {
+	if this.owner == "" {
+		return this.fieldPath
+	}
+	return this.owner + ":" + this.fieldPath
+}
+
+// 检查环境变量名的冲突：
+// 同一个环境变量名只能对应同一个目录（不同的片段可以共享目录），文件则不能共享环境变量名。
+func envKeyCollisions(nodes []collisionNode) []Collision {
+	groups := make(map[string][]collisionNode)
+	keys := make([]string, 0)
+	for _, n := range nodes {
+		// 别名同样不能冲突
+		for _, key := range n.envKeys {
+			if _, ok := groups[key]; !ok {
+				keys = append(keys, key)
+			}
+			groups[key] = append(groups[key], n)
+		}
+	}
+	res := make([]Collision, 0)
+	for _, key := range keys {
+		group := groups[key]
+		if len(group) < 2 || isSharedDir(group) {
+			continue
+		}
+		res = append(res, Collision{
+			Kind:   CollisionKind.EnvKey,
+			Value:  key,
+			Fields: collisionLabels(group),
+		})
+	}
+	return res
+}
+
+// 检查探测结果的冲突：不同的文件不能指向同一个路径
+func pathCollisions(nodes []collisionNode) []Collision {
+	groups := make(map[string][]collisionNode)
+	paths := make([]string, 0)
+	for _, n := range nodes {
+		if n.isDir || n.resolved == "" {
+			continue
+		}
+		if _, ok := groups[n.resolved]; !ok {
+			paths = append(paths, n.resolved)
+		}
+		groups[n.resolved] = append(groups[n.resolved], n)
+	}
+	res := make([]Collision, 0)
+	for _, p := range paths {
+		if group := groups[p]; len(group) > 1 {
+			res = append(res, Collision{
+				Kind:   CollisionKind.Path,
+				Value:  p,
+				Fields: collisionLabels(group),
+			})
+		}
+	}
+	return res
+}
+
+// 都是同一个相对路径的目录，且分属不同的片段，则看做共享的目录
+func isSharedDir(group []collisionNode) bool {
+	owners := make(map[string]bool, len(group))
+	for _, n := range group {
+		if !n.isDir || n.namePath != group[0].namePath || owners[n.owner] {
+			return false
+		}
+		owners[n.owner] = true
+	}
+	return true
+}
+
+// 根据探测结果检查所有Schema之间及内部的路径冲突
+func boundPathCollisions(bound []boundSchema) []Collision {
+	nodes := make([]collisionNode, 0)
+	for _, b := range bound {
+		for _, n := range b.sch.nodes {
+			if n.targetIdx < 0 {
+				continue
+			}
+			// []string成员的每个路径都参与检查
+			for _, p := range targetPaths(b.targets[n.targetIdx]) {
+				nodes = append(nodes, collisionNode{schemaNode: n, owner: b.name, resolved: p})
+			}
+		}
+	}
+	return pathCollisions(nodes)
+}
+
+// 存在冲突时，默认返回*CollisionError，宽松模式下则只作为警告输出到logger
+func (this *detector) checkCollisions(collisions []Collision) error {
+	if len(collisions) == 0 {
+		return nil
+	}
+	if !this.lenient {
+		return &CollisionError{Collisions: collisions}
+	}
+	for _, c := range collisions {
+		this.logger.Println("[WARN]" + c.String())
+	}
+	return nil
+}
+
+func collisionLabels(group []collisionNode) []string {
+	res := make([]string, 0, len(group))
+	for _, n := range group {
+		res = append(res, n.label())
+	}
+	sort.Strings(res)
+	return res
+}
@@ -0,0 +1,48 @@
+package detector
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestEnvKeyCollision(t *testing.T) {
+	typ := reflect.TypeOf(struct {
+		Conf struct {
+			DBConfig  string
+			DB_Config string
+		}
+	}{})
+	_, err := NewDetector().Compile(typ)
+	cErr, ok := err.(*CollisionError)
+	if !ok || len(cErr.Collisions) != 1 ||
+		!reflect.DeepEqual(cErr.Collisions[0].Fields, []string{"Conf.DBConfig", "Conf.DB_Config"}) {
+		t.Error("应该报告环境变量名的冲突：", err)
+	}
+	if _, err = NewDetector().WithLenient().Compile(typ); err != nil {
+		t.Error("宽松模式下不应该报错：", err)
+	}
+}
+
+func TestPathCollision(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	ioutil.WriteFile(filepath.Join(dir, "db.yaml"), nil, 0644)
+
+	layout := &struct {
+		DBYaml string
+		Config string `pd:"Name(db.yaml);Key(APP_CONFIG)"`
+	}{}
+	err = NewDetector().WithDir(dir).Detect(layout)
+	if err == nil {
+		t.Error("应该报告路径冲突")
+	}
+	if err = NewDetector().WithDir(dir).WithLenient().Detect(layout); err != nil || layout.Config != layout.DBYaml {
+		t.Error("宽松模式下不应该报错：", err)
+	}
+}
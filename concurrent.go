@@ -0,0 +1,125 @@
+package detector
+
+import (
+	"context"
+)
+
+// 一个成员同时探测的结果
+type concurrentResult struct {
+	id  int
+	res stepResult
+}
+
+// 同时探测最多n个成员。
+// 依赖的成员有了探测结果后就可以开始探测，结果仍然按探测顺序交给detectRun处理，
+// 提前探测时使用的依赖与按顺序处理时不一致（如依赖被跳过）的，按顺序处理时重新探测，
+// 因此结果、输出及出错时的错误都与按顺序探测一致。
+func (this *Schema) detectConcurrent(run *detectRun, n int) error {
+	state := run.state
+	// 返回后还在探测的成员尽快结束
+	ctx, cancel := context.WithCancel(state.call.ctx)
+	defer cancel()
+	call := *state.call
+	call.ctx = ctx
+	worker := *state
+	worker.call = &call
+
+	// 提前探测的结果，以及探测时看到的路径
+	results := make([]*stepResult, len(this.steps))
+	paths := make([]string, len(this.steps))
+	paths[0] = state.paths[0]
+	// 已经开始探测（或者确定不需要提前探测）的成员
+	started := make([]bool, len(this.steps))
+	// 已经有探测结果（或者确定不需要提前探测）的成员
+	settled := make([]bool, len(this.steps))
+	settled[0] = true
+	// 缓冲足够大，提前返回后worker也不会阻塞
+	done := make(chan concurrentResult, len(this.steps))
+	running := 0
+
+	// 按探测顺序开始探测依赖已经有结果的成员
+	start := func(pos int) {
+		for _, id := range this.order[pos:] {
+			if running >= n {
+				return
+			}
+			if started[id] || !this.depsSettled(id, settled) {
+				continue
+			}
+			started[id] = true
+			if paths[this.steps[id].parent] == "" {
+				// 所在目录没有结果，按顺序处理时一定会跳过或者重新探测
+				settled[id] = true
+				continue
+			}
+			running++
+			s := worker.fork(append([]string{}, paths...))
+			go func(id int) {
+				done <- concurrentResult{id: id, res: this.runStep(s, id)}
+			}(id)
+		}
+	}
+
+	pos := 0
+	for {
+		start(pos)
+		// 按顺序处理已经有结果的成员
+		for ; pos < len(this.order); pos++ {
+			id := this.order[pos]
+			if err := ctx.Err(); err != nil {
+				return run.canceled(err)
+			}
+			if !run.need(id) {
+				continue
+			}
+			if started[id] && !settled[id] {
+				// 等待探测结果
+				break
+			}
+			res := results[id]
+			if res == nil || !this.sameDeps(id, paths, state.paths) {
+				// 没有提前探测，或者提前探测时的依赖不一致，使用按顺序处理的结果重新探测
+				r := this.runStep(state, id)
+				res = &r
+				if !started[id] && r.err == nil {
+					// 还没有成员使用过该成员的结果
+					paths[id] = r.paths[0]
+				}
+				started[id], settled[id] = true, true
+			}
+			if err := run.commit(id, *res); err != nil {
+				return err
+			}
+		}
+		if pos == len(this.order) {
+			break
+		}
+
+		r := <-done
+		running--
+		results[r.id], settled[r.id] = &r.res, true
+		if r.res.err == nil {
+			paths[r.id] = r.res.paths[0]
+		}
+	}
+	return run.result()
+}
+
+func (this *Schema) depsSettled(id int, settled []bool) bool {
+	for _, dep := range this.steps[id].deps {
+		if !settled[dep] {
+			return false
+		}
+	}
+	return true
+}
+
+// 提前探测时看到的依赖的路径与按顺序处理时一致
+func (this *Schema) sameDeps(id int, early, paths []string) bool {
+	for _, dep := range this.steps[id].deps {
+		if early[dep] != paths[dep] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,92 @@
+package detector
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestWithConcurrency(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for _, p := range []string{"conf/db.yaml", "conf/redis.yaml", "data/a.db", "logs/app.log", "cache/tmp/x.bin", "opt/ok.yaml"} {
+		os.MkdirAll(filepath.Join(dir, filepath.Dir(p)), 0755)
+		ioutil.WriteFile(filepath.Join(dir, p), nil, 0644)
+	}
+
+	type layout struct {
+		Conf struct {
+			Path      string
+			DBYaml    string
+			RedisYaml string
+		}
+		Data struct {
+			ADb string
+		}
+		Logs struct {
+			AppLog string
+		}
+		Cache struct {
+			Tmp struct {
+				XBin string
+			}
+		}
+		// 可选目录中缺少文件时整个目录跳过
+		Opt struct {
+			OkYaml   string
+			MissYaml string
+		} `pd:"Opt"`
+		NearDB string `pd:"Name(redis.yaml);Near(Conf.DBYaml)"`
+		RefLog string `pd:"Name(app.log);Priority(${Logs.Path})"`
+	}
+	detect := func(n int, v interface{}) (string, error) {
+		buf := &bytes.Buffer{}
+		err := NewDetector().WithLenient().WithConcurrency(n).WithDir(dir).Debug(buf).Detect(v)
+		return buf.String(), err
+	}
+
+	var seq layout
+	seqLog, err := detect(1, &seq)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 20; i++ {
+		var v layout
+		log, err := detect(4, &v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(v, seq) {
+			t.Fatalf("同时探测的结果应该与按顺序探测一致：\n%+v\n%+v", v, seq)
+		}
+		if log != seqLog {
+			t.Fatalf("同时探测的输出应该与按顺序探测一致：\n%s\n%s", log, seqLog)
+		}
+	}
+
+	// 出错时报告按顺序探测时的第一个错误
+	type broken struct {
+		Conf struct {
+			DBYaml   string
+			MissYaml string
+		}
+		Data struct {
+			MissDb string
+		}
+	}
+	_, seqErr := detect(1, &broken{})
+	if seqErr == nil {
+		t.Fatal("应该报错")
+	}
+	for i := 0; i < 20; i++ {
+		if _, err := detect(4, &broken{}); err == nil || err.Error() != seqErr.Error() {
+			t.Fatalf("同时探测的错误应该与按顺序探测一致：\n%v\n%v", err, seqErr)
+		}
+	}
+}
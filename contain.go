@@ -0,0 +1,82 @@
+package detector
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// 路径不在允许的目录中，见WithAllowedRoots、Contained()
+type ContainmentError struct {
+	// 成员路径，形如`Conf.DitFile`
+	Field string
+	// 探测到的路径
+	Path string
+	// 允许的目录
+	Roots []string
+}
+
+func (this *ContainmentError) Error() string {
+	return fmt.Sprintf("安全检查失败：成员%s的路径'%s'（解析符号链接后）不在允许的目录中：'%s'", this.Field, this.Path, strings.Join(this.Roots, "'、'"))
+}
+
+// 成员是否需要检查路径在允许的目录中
+func (this *detectState) contained(tag envTag) bool {
+	return tag.Contained || len(this._detector.allowedRoots) > 0
+}
+
+// 检查路径解析符号链接后在工作目录、父目录或者WithAllowedRoots中的目录下
+func (this *detectState) checkContained(field, path, parentPath string) error {
+	roots := make([]string, 0, len(this._detector.allowedRoots)+2)
+	roots = append(roots, this.baseDir)
+	if parentPath != "" && parentPath != this.baseDir {
+		roots = append(roots, parentPath)
+	}
+	for _, root := range this._detector.allowedRoots {
+		root, err := this.resolve(root, this.baseDir)
+		if err != nil {
+			return fmt.Errorf("WithAllowedRoots%s", err.Error())
+		}
+		roots = append(roots, root)
+	}
+	_, err := this.probe(path, func() (string, error) {
+		for _, root := range roots {
+			if containedIn(root, path) {
+				return path, nil
+			}
+		}
+		return "", &ContainmentError{Field: field, Path: path, Roots: roots}
+	})
+	return err
+}
+
+// 路径在目录root下（按字面）时，返回相对路径
+func relIn(root, path string) (string, bool) {
+	rel, err := filepath.Rel(root, path)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", false
+	}
+	return rel, true
+}
+
+// 解析路径中已经存在的部分的符号链接，不存在的部分按原样拼接
+func evalExisting(path string) (string, error) {
+	path = filepath.Clean(path)
+	real, err := filepath.EvalSymlinks(path)
+	if err == nil {
+		return real, nil
+	}
+	if !os.IsNotExist(err) {
+		return "", err
+	}
+	parent := filepath.Dir(path)
+	if parent == path {
+		return path, nil
+	}
+	real, err = evalExisting(parent)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(real, filepath.Base(path)), nil
+}
@@ -0,0 +1,17 @@
+//go:build !go1.24
+
+package detector
+
+// 解析符号链接后比较路径，检查path是否仍然在root下
+func containedIn(root, path string) bool {
+	realRoot, err := evalExisting(root)
+	if err != nil {
+		return false
+	}
+	realPath, err := evalExisting(path)
+	if err != nil {
+		return false
+	}
+	_, ok := relIn(realRoot, realPath)
+	return ok
+}
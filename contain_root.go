@@ -0,0 +1,40 @@
+//go:build go1.24
+
+package detector
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// 通过os.Root检查path解析符号链接后是否仍然在root下，不存在的部分不再检查
+func containedIn(root, path string) bool {
+	rel, ok := relIn(root, path)
+	if !ok {
+		// 已经解析过符号链接的路径（如Symlink(resolve)）需要与解析后的root比较
+		realRoot, err := filepath.EvalSymlinks(root)
+		if err != nil {
+			return false
+		}
+		if rel, ok = relIn(realRoot, path); !ok {
+			return false
+		}
+		root = realRoot
+	}
+	r, err := os.OpenRoot(root)
+	if err != nil {
+		return false
+	}
+	defer r.Close()
+	for {
+		_, err := r.Stat(rel)
+		if err == nil {
+			return true
+		}
+		// 经过指向root以外的符号链接时，os.Root返回的不是不存在的错误
+		if !os.IsNotExist(err) || rel == "." {
+			return false
+		}
+		rel = filepath.Dir(rel)
+	}
+}
@@ -0,0 +1,66 @@
+package detector
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestContained(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	outside, err := ioutil.TempDir("", "pd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(outside)
+	os.MkdirAll(filepath.Join(dir, "conf"), 0755)
+	ioutil.WriteFile(filepath.Join(dir, "conf", "db.yaml"), nil, 0644)
+	ioutil.WriteFile(filepath.Join(outside, "shadow"), nil, 0644)
+	os.Symlink(filepath.Join(outside, "shadow"), filepath.Join(dir, "conf", "link.yaml"))
+
+	type layout struct {
+		Conf struct {
+			DBYaml string `pd:"Contained"`
+		}
+	}
+	var v layout
+	if err := NewDetector().WithDir(dir).Detect(&v); err != nil {
+		t.Fatal(err)
+	}
+
+	// 环境变量指向工作目录以外
+	os.Setenv("PD_CONTAINED_DB", filepath.Join(outside, "shadow"))
+	defer os.Unsetenv("PD_CONTAINED_DB")
+	var v2 struct {
+		Conf struct {
+			DBYaml string `pd:"Key(PD_CONTAINED_DB);Contained"`
+		}
+	}
+	var ce *ContainmentError
+	if err := NewDetector().WithDir(dir).Detect(&v2); !errors.As(err, &ce) || ce.Field != "Conf.DBYaml" {
+		t.Error("应该报告安全错误：", err)
+	}
+	if err := NewDetector().WithDir(dir).WithAllowedRoots(outside).Detect(&v2); err != nil {
+		t.Error("允许的目录中的路径应该通过：", err)
+	}
+
+	// 经过指向外部的符号链接
+	var v3 struct {
+		Conf struct {
+			LinkYaml string
+		}
+	}
+	if err := NewDetector().WithDir(dir).WithAllowedRoots("./conf").Detect(&v3); !errors.As(err, &ce) {
+		t.Error("解析符号链接后在外部时应该报错：", err)
+	}
+	v3.Conf.LinkYaml = ""
+	if err := NewDetector().WithDir(dir).Detect(&v3); err != nil || v3.Conf.LinkYaml == "" {
+		t.Error("默认不检查：", err)
+	}
+}
@@ -1,24 +1,76 @@
 package detector
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"io"
+	logpkg "log"
 	"os"
 	"path/filepath"
 	"reflect"
+	"sync"
+	"time"
 )
 
 type Detector interface {
 	// 根据传入的结构体进行搜索
 	Detect(i interface{}) error
+	// 根据Spec进行搜索，结果按顺序写入targets（*string或者*[]string），供生成的代码使用
+	DetectSpec(spec *Spec, targets []interface{}) error
+	// 与Detect相同，但缺少的必需成员会以递增的间隔重试，直到出现或者超时（timeout<=0时只受ctx限制），
+	// 超时后的错误会列出所有仍然缺少的成员。用于等待sidecar等稍后写入的文件。
+	DetectWait(ctx context.Context, i interface{}, timeout time.Duration) error
+	// 与Detect相同，但在每次检查路径之前检查ctx，ctx结束时返回ctx.Err()
+	DetectContext(ctx context.Context, i interface{}) error
+	// 预先编译结构体的布局并缓存，同一类型、同样配置的Detector之间共享编译结果
+	Compile(t reflect.Type) (*Schema, error)
 	// 直接指定初始目录路径
 	WithDir(dir string) Detector
 	// 统一设置所有环境变量的前缀
 	WithEnvPrefix(prefix string) Detector
+	// 设置环境变量名的生成规则，见EnvKeyStyle，也可以传入自定义的规则
+	WithEnvKeyStyle(style EnvKeyFunc) Detector
 	// 统一设置所有文件的分隔符，默认为`.`
 	WithFileSplit(split string) Detector
 	// 会尝试优先根据`dirEnv`的配置值设置工作目录
 	WithDirEnvKey(dirEnv string) Detector
+	// 忽略结构体中不支持的成员（非string、struct类型或者未导出），而不是报错
+	WithIgnoreUnsupported() Detector
+	// 宽松模式，环境变量名、路径冲突时只输出警告到logger，而不是报错
+	WithLenient() Detector
+	// 设置Priority中相对路径的起点，默认为Anchor.BaseDir，可以通过tag`Anchor(...)`单独设置
+	WithPriorityAnchor(anchor AnchorID) Detector
+	// 设置默认的探测顺序，见Source，可以通过tag`Order(...)`单独设置
+	WithResolutionOrder(order ...SourceID) Detector
+	// 设置根目录的tag，只能使用FileExt、FileSplit、ChildPriority，优先级低于所有成员的tag
+	WithDefaultTag(tag string) Detector
+	// 所有目录、文件匹配名称时忽略大小写，结果使用实际的名称，可以通过tag`IgnoreCase()`单独设置
+	WithCaseInsensitive() Detector
+	// 设置符号链接策略，默认为SymlinkPolicy.Follow，可以通过tag`Symlink(...)`单独设置
+	WithSymlinkPolicy(policy SymlinkPolicyID) Detector
+	// 要求所有成员的路径解析符号链接后在工作目录、父目录或者roots中的目录下，否则返回*ContainmentError，
+	// 只对个别成员检查可以使用tag`Contained()`
+	WithAllowedRoots(roots ...string) Detector
+	// 匹配名称前对名称做转换，如传入norm.NFC.String以兼容NFC、NFD两种Unicode正规化形式
+	WithNameNormalizer(normalize func(string) string) Detector
+	// 在多次探测之间共享目录列表的缓存，目录变化后需要调用cache.Invalidate，默认每次探测使用新的缓存
+	WithDirCache(cache *DirCache) Detector
+	// 设置每次检查路径是否存在的超时，超时的路径视为无法访问（不同于不存在）并报错，默认不限制
+	WithProbeTimeout(timeout time.Duration) Detector
+	// 设置Watch的轮询间隔，默认为5秒
+	WithWatchInterval(interval time.Duration) Detector
+	// Watch时同时使用inotify监听目录变化（仅Linux），不可用时只使用轮询
+	WithInotify() Detector
+
+	// 探测后持续监听，目录变化导致探测结果变化时更新结构体并调用onChange，直到ctx结束。
+	// onChange在Watch所在的goroutine中调用，结构体也在此时更新，其他goroutine读取时需要自行同步。
+	Watch(ctx context.Context, i interface{}, onChange func(Change)) error
+
+	// 设置同时探测的目录、文件数量，结果及出错时的错误与按顺序探测一致，默认按顺序探测
+	WithConcurrency(n int) Detector
+	// 设置警告等信息的输出，默认不输出
+	WithLogger(out io.Writer, prefix string, flag int) Detector
 
 	// 在搜索的同时打印搜索逻辑到log
 	Debug(w io.Writer) Detector
@@ -26,13 +78,21 @@ type Detector interface {
 
 func NewDetector() Detector {
 	return &detector{
-		envPrefix: "",
+		logger:          defaultLogger,
+		pendingProbes:   make(chan struct{}, maxPendingProbes),
+		dirEnvKey:       "",
+		priorityAnchor:  Anchor.BaseDir,
+		resolutionOrder: defaultResolutionOrder,
+		schemaOptions: schemaOptions{
+			envPrefix: "",
 
-		dirEnvKey:              "",
-		directoryNameParseType: NameParseType.SmartSnake,
+			directoryNameParseType: NameParseType.SmartSnake,
 
-		fileSplit:         ".",
-		fileNameParseType: NameParseType.SmartSnake,
+			fileSplit:         ".",
+			fileNameParseType: NameParseType.SmartSnake,
+
+			envKeyStyle: &EnvKeyStyle.Snake,
+		},
 	}
 }
 
@@ -47,88 +107,220 @@ var NameParseType = struct {
 	SmartSnake: 2,
 }
 
-type detector struct {
-	isDebug bool
+type AnchorID = int8
 
-	envPrefix string
+var Anchor = struct {
+	// 相对于工作目录
+	BaseDir AnchorID
+	// 相对于父目录
+	ParentDir AnchorID
+}{
+	BaseDir:   1,
+	ParentDir: 2,
+}
 
-	directoryNameParseType NameParseTypeID
-	dir                    string
-	dirEnvKey              string
-	dirSplit               string
-	dirPrioirity           []string
+type detector struct {
+	isDebug bool
+	logger  *logpkg.Logger
+	// 同时探测的成员数量，不大于1时按顺序探测
+	concurrency int
+	// 宽松模式
+	lenient bool
+	// Priority中相对路径的起点
+	priorityAnchor AnchorID
+	// 默认的探测顺序
+	resolutionOrder []SourceID
+	// 每次检查路径的超时，0表示不限制
+	probeTimeout time.Duration
+	// 还没有返回的检查，见maxPendingProbes
+	pendingProbes chan struct{}
+	// 使用自定义的EnvKeyStyle时的编译缓存，见compileCache
+	schemas sync.Map
+	// 匹配名称时忽略大小写
+	caseInsensitive bool
+	// 符号链接策略
+	symlinkPolicy SymlinkPolicyID
+	// 允许的目录，设置后所有成员都需要在其中
+	allowedRoots []string
+	// 匹配名称前对名称做的转换，如Unicode正规化
+	nameNormalizer func(string) string
+	// 在多次探测之间共享的目录列表缓存，nil表示每次探测使用新的缓存
+	dirCache *DirCache
+	// Watch的配置
+	watchInterval time.Duration
+	watchInotify  bool
 
-	fileNameParseType NameParseTypeID
-	fileSplit         string
+	dir          string
+	dirEnvKey    string
+	dirPrioirity []string
 	// baseDir string
+
+	// 会影响Schema编译结果的配置
+	schemaOptions
 }
 
 func (this *detector) Detect(i interface{}) error {
-	var err error
+	return this.detect(this.newCall(context.Background()), i)
+}
+
+func (this *detector) DetectContext(ctx context.Context, i interface{}) error {
+	return this.detect(this.newCall(ctx), i)
+}
+
+func (this *detector) detect(call *detectCall, i interface{}) error {
 	t := reflect.TypeOf(i)
 	v := reflect.ValueOf(i)
 	if t.Kind() != reflect.Ptr {
 		return fmt.Errorf("%T不是Ptr", i)
 	}
+	sch, err := this.Compile(t)
+	if err != nil {
+		return err
+	}
+	return this.detectSchemas(call, boundSchema{sch: sch, targets: sch.bind(v.Elem())})
+}
+
+func (this *detector) DetectSpec(spec *Spec, targets []interface{}) error {
+	sch, err := this.compileSpec(spec)
+	if err != nil {
+		return err
+	}
+	if sch.numTargets != len(targets) {
+		return fmt.Errorf("Spec需要%d个targets，实际传入%d个", sch.numTargets, len(targets))
+	}
+	return this.detectSchemas(this.newCall(context.Background()), boundSchema{sch: sch, targets: targets})
+}
+
+// 已经绑定了探测结果的Schema
+type boundSchema struct {
+	// 多个Schema一起探测时用于区分，见Registry
+	name    string
+	sch     *Schema
+	targets []interface{}
+}
+
+// 使用同一个工作目录探测所有的Schema
+func (this *detector) detectSchemas(call *detectCall, bound ...boundSchema) error {
+	err := this.tryBaseDirs(call, bound)
+	if err != nil && call.ctx.Err() != nil && !call.waitAll {
+		// 被取消时直接返回ctx的错误，便于调用方判断；DetectWait需要列出缺少的成员
+		return call.ctx.Err()
+	}
+	return err
+}
 
+// 依次尝试各个工作目录
+func (this *detector) tryBaseDirs(call *detectCall, bound []boundSchema) error {
+	var err error
 	// 如果直接指定了初始目录，则只使用该目录，失败了就报错
 	if this.dir != "" {
-		if !dirExist(this.dir) {
-			return fmt.Errorf("指定目录'%s'不存在", this.dir)
+		dir, err := expandPath(this.dir, expandVars{})
+		if err != nil {
+			return fmt.Errorf("指定目录%s", err.Error())
+		}
+		if ok, err := call.dirExist(dir); err != nil {
+			return fmt.Errorf("检查指定目录时出错：%w", err)
+		} else if !ok {
+			return fmt.Errorf("指定目录'%s'不存在", dir)
 		}
-		if err = this.tryDetector(this.dir, v); err == nil {
+		if err = this.tryDetector(call, dir, bound); err == nil {
 			return nil
 		} else {
-			return fmt.Errorf("无法根据根指定目录'%s'提供的参数%s推导: %s", this.dir, this.dir, err.Error())
+			return fmt.Errorf("无法根据根指定目录'%s'提供的参数%s推导: %w", this.dir, dir, err)
 		}
 	}
 
 	// 首先如果环境变量设置了，则只使用环境变量，失败了就报错
 	if baseDir := this.getBaseDirByEnv(); baseDir != "" {
 		// log.Println("Env BaseDir", baseDir)
-		if err = this.tryDetector(baseDir, v); err == nil {
+		if baseDir, err = expandPath(baseDir, expandVars{}); err != nil {
+			return fmt.Errorf("环境变量%s%s", this.dirEnvKey, err.Error())
+		}
+		if err = this.tryDetector(call, baseDir, bound); err == nil {
 			return nil
 		} else {
-			return fmt.Errorf("无法根据根据环境变量%s提供的参数%s推导: %s", this.dirEnvKey, baseDir, err.Error())
+			return fmt.Errorf("无法根据根据环境变量%s提供的参数%s推导: %w", this.dirEnvKey, baseDir, err)
 		}
 	}
 
-	// 用命令执行目录尝试（兼容go run）
-	if baseDir := this.getBaseDirByWD(); baseDir != "" {
-		// log.Println("OSWDBaseDir", baseDir)
-		if err2 := this.tryDetector(baseDir, v); err2 == nil {
+	// 用命令执行目录（兼容go run）、可执行文件所在的目录依次尝试
+	bases := make([]baseDirCandidate, 0, 2)
+	if baseDir, err2 := this.getBaseDirByWD(call); err2 != nil {
+		err = err2
+	} else if baseDir != "" {
+		bases = append(bases, baseDirCandidate{dir: baseDir, desc: "os.Getwd()=" + baseDir})
+	}
+	if baseDir, err2 := this.getBaseDirByOSArgs(call); err2 != nil {
+		err = err2
+	} else if baseDir != "" {
+		bases = append(bases, baseDirCandidate{dir: baseDir, desc: "OSArgs[0]=" + baseDir})
+	}
+
+	// 先不等待地尝试每个目录，避免在错误的目录下等待缺少的成员
+	first := *call
+	first.noWait = true
+	chosen, fewest := -1, 0
+	for i, base := range bases {
+		err2 := this.tryDetector(&first, base.dir, bound)
+		if err2 == nil {
 			return nil
-		} else {
-			if err != nil {
-				err = fmt.Errorf("%s;无法根据os.Getwd()=%s推导：%s", err.Error(), baseDir, err2.Error())
-			} else {
-				err = err2
-			}
+		}
+		err = fmt.Errorf("无法根据%s推导：%w", base.desc, err2)
+		// 只缺少需要等待的成员时，选择缺少的最少的目录
+		var missing *waitMissingError
+		if errors.As(err2, &missing) && (chosen < 0 || missing.count < fewest) {
+			chosen, fewest = i, missing.count
 		}
 	}
-	// 用os.Args[0]尝试（可执行文件所在的目录尝试）
-	if baseDir := this.getBaseDirByOSArgs(); baseDir != "" {
-		// log.Println("ArgsBaseDir", baseDir)
-		if err = this.tryDetector(baseDir, v); err == nil {
-			return nil
-		} else {
-			err = fmt.Errorf("无法根据OSArgs[0]=%s推导：%s", baseDir, err.Error())
+	if chosen >= 0 {
+		base := bases[chosen]
+		if err = this.tryDetector(call, base.dir, bound); err != nil {
+			return fmt.Errorf("无法根据%s推导：%w", base.desc, err)
 		}
+		return nil
 	}
 
-	return fmt.Errorf("无法找到工作目录，可能因为：%s", err.Error())
+	if err == nil {
+		return errors.New("无法找到工作目录")
+	}
+	return fmt.Errorf("无法找到工作目录，可能因为：%w", err)
 }
 
-func (this *detector) tryDetector(baseDir string, v reflect.Value) error {
-	dirSch, err := this.newDirSchema(v.Elem(), nil, nil)
-	if err != nil {
+// 没有指定工作目录时依次尝试的目录
+type baseDirCandidate struct {
+	dir string
+	// 目录的来源，用于错误信息
+	desc string
+}
+
+func (this *detector) tryDetector(call *detectCall, baseDir string, bound []boundSchema) error {
+	if err := this.tryDetectorOnce(call, baseDir, bound); err != nil {
 		return err
 	}
-	dirSch.Path = baseDir
-	err = dirSch.detector()
+	// 不同的文件不能指向同一个路径
+	return this.checkCollisions(boundPathCollisions(bound))
+}
+
+func (this *detector) tryDetectorOnce(call *detectCall, baseDir string, bound []boundSchema) error {
+	// 探测结果总是绝对路径
+	baseDir, err := filepath.Abs(baseDir)
 	if err != nil {
 		return err
 	}
+	for _, b := range bound {
+		state := &detectState{
+			_detector: this,
+			call:      call,
+			baseDir:   baseDir,
+			targets:   b.targets,
+		}
+		if err := b.sch.detect(state, baseDir); err != nil {
+			if b.name != "" {
+				return fmt.Errorf("处理%s出错{%w}", b.name, err)
+			}
+			return err
+		}
+	}
 	return nil
 }
 
@@ -137,6 +329,12 @@ func (this *detector) WithEnvPrefix(prefix string) Detector {
 	return this
 }
 
+// 设置环境变量名的生成规则，见EnvKeyStyle，也可以传入自定义的规则
+func (this *detector) WithEnvKeyStyle(style EnvKeyFunc) Detector {
+	this.envKeyStyle = envKeyStyleRef(style)
+	return this
+}
+
 // 统一设置所有文件名的分隔符，默认为`.`
 func (this *detector) WithFileSplit(split string) Detector {
 	this.fileSplit = split
@@ -149,16 +347,114 @@ func (this *detector) WithDirEnvKey(dirEnv string) Detector {
 	return this
 }
 
+// 忽略结构体中不支持的成员（非string、struct类型或者未导出），而不是报错
+func (this *detector) WithIgnoreUnsupported() Detector {
+	this.ignoreUnsupported = true
+	return this
+}
+
+// 宽松模式，环境变量名、路径冲突时只输出警告到logger，而不是报错
+func (this *detector) WithLenient() Detector {
+	this.lenient = true
+	return this
+}
+
+// 设置Priority中相对路径的起点，默认为Anchor.BaseDir，可以通过tag`Anchor(...)`单独设置
+func (this *detector) WithPriorityAnchor(anchor AnchorID) Detector {
+	this.priorityAnchor = anchor
+	return this
+}
+
+// 设置默认的探测顺序，见Source，可以通过tag`Order(...)`单独设置。
+// 顺序非法时在编译（Compile、Detect）时报错。
+func (this *detector) WithResolutionOrder(order ...SourceID) Detector {
+	this.resolutionOrder = append([]SourceID{}, order...)
+	return this
+}
+
+// 设置根目录的tag，只能使用FileExt、FileSplit、ChildPriority，优先级低于所有成员的tag。
+// tag非法时在编译（Compile、Detect）时报错。
+func (this *detector) WithDefaultTag(tag string) Detector {
+	this.defaultTag = tag
+	return this
+}
+
+// 所有目录、文件匹配名称时忽略大小写，结果使用实际的名称，可以通过tag`IgnoreCase()`单独设置。
+// 目录中有多个只有大小写不同的名称时报错。
+func (this *detector) WithCaseInsensitive() Detector {
+	this.caseInsensitive = true
+	return this
+}
+
+// 设置符号链接策略，默认为SymlinkPolicy.Follow，可以通过tag`Symlink(...)`单独设置
+func (this *detector) WithSymlinkPolicy(policy SymlinkPolicyID) Detector {
+	this.symlinkPolicy = policy
+	return this
+}
+
+// 要求所有成员的路径解析符号链接后在工作目录、父目录或者roots中的目录下，否则返回*ContainmentError。
+// roots中的相对路径以工作目录为起点，支持变量展开。只对个别成员检查可以使用tag`Contained()`。
+func (this *detector) WithAllowedRoots(roots ...string) Detector {
+	this.allowedRoots = append([]string{}, roots...)
+	return this
+}
+
+// 匹配名称前对名称做转换，如传入golang.org/x/text/unicode/norm的norm.NFC.String，
+// 以兼容从macOS复制的NFD形式的文件名。
+func (this *detector) WithNameNormalizer(normalize func(string) string) Detector {
+	this.nameNormalizer = normalize
+	return this
+}
+
+// 在多次探测之间共享目录列表的缓存，目录变化后需要调用cache.Invalidate，默认每次探测使用新的缓存。
+// Watch每次重新探测之前会清空该缓存。
+func (this *detector) WithDirCache(cache *DirCache) Detector {
+	this.dirCache = cache
+	return this
+}
+
+// 设置每次检查路径是否存在的超时，超时的路径视为无法访问（不同于不存在）并报错，默认不限制。
+// 超时的检查会留在后台直到返回，同时在等待的检查超过上限时，新的检查直接视为无法访问。
+func (this *detector) WithProbeTimeout(timeout time.Duration) Detector {
+	this.probeTimeout = timeout
+	return this
+}
+
+// 设置Watch的轮询间隔，默认为5秒
+func (this *detector) WithWatchInterval(interval time.Duration) Detector {
+	this.watchInterval = interval
+	return this
+}
+
+// Watch时同时使用inotify监听目录变化（仅Linux），不可用时只使用轮询
+func (this *detector) WithInotify() Detector {
+	this.watchInotify = true
+	return this
+}
+
 // 直接指定初始目录路径
 func (this *detector) WithDir(dir string) Detector {
 	this.dir = dir
 	return this
 }
 
+// 设置同时探测的目录、文件数量，结果及出错时的错误与按顺序探测一致，默认按顺序探测。
+// 适合目录较多、检查路径较慢（如网络存储）的情况。
+func (this *detector) WithConcurrency(n int) Detector {
+	this.concurrency = n
+	return this
+}
+
+// 设置警告等信息的输出，默认不输出
+func (this *detector) WithLogger(out io.Writer, prefix string, flag int) Detector {
+	this.logger = logpkg.New(out, prefix, flag)
+	return this
+}
+
 // 在搜索的同时打印搜索逻辑到logger
 func (this *detector) Debug(output io.Writer) Detector {
 	this.isDebug = true
-	SetLogger(output, "[DEBUG]", 0)
+	this.logger = logpkg.New(output, "[DEBUG]", 0)
 	return this
 }
 
@@ -175,25 +471,33 @@ func (this *detector) getBaseDirByEnv() string {
 }
 
 // 可执行文件所在目录
-func (this *detector) getBaseDirByOSArgs() string {
+func (this *detector) getBaseDirByOSArgs(call *detectCall) (string, error) {
 	appPath, err := filepath.Abs(filepath.Dir(os.Args[0]))
 	if err == nil {
-		if dirExist(appPath) {
+		ok, err := call.dirExist(appPath)
+		if err != nil {
+			return "", fmt.Errorf("无法检查OSArgs[0]=%s：%w", appPath, err)
+		}
+		if ok {
 			// log.Printf("os.Args[0] = %s", appPath)
-			return appPath
+			return appPath, nil
 		}
 	}
-	return ""
+	return "", nil
 }
 
 // 执行目录（兼容go run）
-func (this *detector) getBaseDirByWD() string {
+func (this *detector) getBaseDirByWD(call *detectCall) (string, error) {
 	workPath, err := os.Getwd()
 	if err == nil {
-		if dirExist(workPath) {
+		ok, err := call.dirExist(workPath)
+		if err != nil {
+			return "", fmt.Errorf("无法检查os.Getwd()=%s：%w", workPath, err)
+		}
+		if ok {
 			// log.Printf("os.Getwd() = %s", workPath)
-			return workPath
+			return workPath, nil
 		}
 	}
-	return ""
+	return "", nil
 }
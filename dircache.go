@@ -0,0 +1,249 @@
+package detector
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// 按目录缓存的目录列表，检查路径时读取一次所在目录，之后同一目录下的检查不再访问文件系统。
+// 每次探测默认使用新的缓存，可以通过WithDirCache在多次探测之间共享，此时需要在目录变化后调用Invalidate。
+// 可以在多个goroutine中使用。
+type DirCache struct {
+	mu   sync.Mutex
+	dirs map[string]*dirListing
+}
+
+func NewDirCache() *DirCache {
+	return &DirCache{dirs: make(map[string]*dirListing)}
+}
+
+// 一个目录的列表
+type dirListing struct {
+	// 读取完成后关闭
+	ready chan struct{}
+	// 目录不存在或者不是目录时为nil
+	entries map[string]dirEntry
+	// 读取目录出错（非不存在），此时直接检查路径
+	err error
+}
+
+// 目录中的一项，符号链接为指向的目标
+type dirEntry struct {
+	isDir bool
+	// 符号链接指向的目标不存在时为false
+	exist bool
+	// 失效的符号链接指向的路径
+	link string
+}
+
+// 使目录的缓存失效，不传入参数时清空所有的缓存
+func (this *DirCache) Invalidate(dirs ...string) {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	if len(dirs) == 0 {
+		this.dirs = make(map[string]*dirListing)
+		return
+	}
+	for _, dir := range dirs {
+		delete(this.dirs, filepath.Clean(dir))
+	}
+}
+
+// 读取目录的列表，同一目录只读取一次，同时读取时等待第一次的结果
+func (this *DirCache) listing(dir string) *dirListing {
+	this.mu.Lock()
+	l, ok := this.dirs[dir]
+	if !ok {
+		l = &dirListing{ready: make(chan struct{})}
+		this.dirs[dir] = l
+	}
+	this.mu.Unlock()
+	if ok {
+		<-l.ready
+		return l
+	}
+	// 在锁外读取，挂起的目录不影响其他目录
+	defer close(l.ready)
+	list, err := os.ReadDir(dir)
+	if err != nil {
+		if !os.IsNotExist(err) && !isNotDir(dir) {
+			l.err = err
+		}
+		return l
+	}
+	l.entries = make(map[string]dirEntry, len(list))
+	for _, e := range list {
+		entry := dirEntry{isDir: e.IsDir(), exist: true}
+		if e.Type()&os.ModeSymlink != 0 {
+			// 符号链接需要检查指向的目标，如Kubernetes挂载卷中的`..data`
+			fi, err := os.Stat(filepath.Join(dir, e.Name()))
+			entry.exist = err == nil || !os.IsNotExist(err)
+			entry.isDir = err == nil && fi.IsDir()
+			if !entry.exist {
+				entry.link, _ = os.Readlink(filepath.Join(dir, e.Name()))
+			}
+		}
+		l.entries[e.Name()] = entry
+	}
+	return l
+}
+
+func isNotDir(path string) bool {
+	fi, err := os.Stat(path)
+	return err == nil && !fi.IsDir()
+}
+
+// 查找路径对应的项，无法通过目录列表判断时ok为false，所在目录不存在时视为不存在
+func (this *DirCache) lookup(path string) (entry dirEntry, ok bool) {
+	path = filepath.Clean(path)
+	dir, name := filepath.Split(path)
+	if name == "" || name == "." || name == ".." || dir == "" {
+		return entry, false
+	}
+	l := this.listing(filepath.Clean(dir))
+	if l.err != nil {
+		return entry, false
+	}
+	entry, ok = l.entries[name]
+	if !ok && l.hasNearName(name) {
+		// 大小写不敏感或者会正规化名称（如macOS的NFD）的文件系统上，按其他形式的名称也能访问到列表中的项，
+		// 此时直接检查；其他不在列表中的名称视为不存在
+		return entry, false
+	}
+	return entry, true
+}
+
+// 列表中是否有与name只是大小写不同的名称；name含有非ASCII字符时，可能只是Unicode正规化的形式不同，总是视为有
+func (this *dirListing) hasNearName(name string) bool {
+	if this.entries == nil {
+		return false
+	}
+	for i := 0; i < len(name); i++ {
+		if name[i] >= utf8.RuneSelf {
+			return true
+		}
+	}
+	for n := range this.entries {
+		if strings.EqualFold(n, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// 与fileExist一致，目录也视为存在
+func (this *DirCache) fileExist(path string) bool {
+	if entry, ok := this.lookup(path); ok {
+		return entry.exist
+	}
+	return fileExist(path)
+}
+
+func (this *DirCache) dirExist(path string) bool {
+	if entry, ok := this.lookup(path); ok {
+		return entry.exist && entry.isDir
+	}
+	return dirExist(path)
+}
+
+// 已经读取过的目录中的名称，按名称排序，isDir为true时只返回目录。
+// 不会读取目录，目录还没有读取完成时返回nil。
+func (this *DirCache) cachedNames(dir string, isDir bool) []string {
+	this.mu.Lock()
+	l, ok := this.dirs[filepath.Clean(dir)]
+	this.mu.Unlock()
+	if !ok {
+		return nil
+	}
+	select {
+	case <-l.ready:
+	default:
+		return nil
+	}
+	res := make([]string, 0, len(l.entries))
+	for name, entry := range l.entries {
+		if entry.exist && (!isDir || entry.isDir) {
+			res = append(res, name)
+		}
+	}
+	sort.Strings(res)
+	return res
+}
+
+// 在目录dir下按目录列表匹配name，name可以包含子目录，每一级分别匹配。
+// fold为true时忽略大小写，normalize不为nil时比较转换后的名称。
+// 返回实际的路径，不存在时返回空，有多个匹配的名称时报错。
+func (this *DirCache) match(dir, name string, isDir, fold bool, normalize func(string) string) (string, error) {
+	parts := strings.Split(filepath.ToSlash(filepath.Clean(name)), "/")
+	cur := filepath.Clean(dir)
+	for i, part := range parts {
+		if part == "." || part == ".." {
+			cur = filepath.Join(cur, part)
+			continue
+		}
+		wantDir := isDir || i < len(parts)-1
+		l := this.listing(cur)
+		if l.err != nil {
+			// 无法读取目录，只能按原来的名称检查
+			cur = filepath.Join(cur, part)
+			if (wantDir && !dirExist(cur)) || !fileExist(cur) {
+				return "", nil
+			}
+			continue
+		}
+		matches := make([]string, 0, 1)
+		for n, entry := range l.entries {
+			if entry.exist && (!wantDir || entry.isDir) && sameName(n, part, fold, normalize) {
+				matches = append(matches, n)
+			}
+		}
+		switch len(matches) {
+		case 0:
+			return "", nil
+		case 1:
+			cur = filepath.Join(cur, matches[0])
+		default:
+			sort.Strings(matches)
+			return "", fmt.Errorf("目录'%s'中有多个名称与'%s'匹配：'%s'", cur, part, strings.Join(matches, "'、'"))
+		}
+	}
+	return cur, nil
+}
+
+func sameName(a, b string, fold bool, normalize func(string) string) bool {
+	if normalize != nil {
+		a, b = normalize(a), normalize(b)
+	}
+	if fold {
+		return strings.EqualFold(a, b)
+	}
+	return a == b
+}
+
+// 路径是否是失效的符号链接，返回其指向的路径
+func (this *DirCache) danglingLink(path string) (string, bool) {
+	path = filepath.Clean(path)
+	dir, name := filepath.Split(path)
+	if name == "" || dir == "" {
+		return "", false
+	}
+	l := this.listing(filepath.Clean(dir))
+	if l.err != nil {
+		// 无法读取目录，直接检查
+		if fi, err := os.Lstat(path); err != nil || fi.Mode()&os.ModeSymlink == 0 {
+			return "", false
+		}
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			return "", false
+		}
+		link, _ := os.Readlink(path)
+		return link, true
+	}
+	entry, ok := l.entries[name]
+	return entry.link, ok && !entry.exist
+}
@@ -0,0 +1,71 @@
+package detector
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDirCache(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	os.MkdirAll(filepath.Join(dir, "..v1", "conf"), 0755)
+	ioutil.WriteFile(filepath.Join(dir, "db.yaml"), nil, 0644)
+	os.Symlink("..v1", filepath.Join(dir, "..data"))
+	os.Symlink("not_exist", filepath.Join(dir, "broken"))
+
+	c := NewDirCache()
+	cases := []struct {
+		path        string
+		file, isDir bool
+	}{
+		{"db.yaml", true, false},
+		{"..v1", true, true},
+		{"..data", true, true},
+		{"..data/conf", true, true},
+		{"broken", false, false},
+		{"redis.yaml", false, false},
+		{"db.yaml/x", false, false},
+		{"not_exist/x", false, false},
+	}
+	for _, c2 := range cases {
+		path := filepath.Join(dir, c2.path)
+		if c.fileExist(path) != c2.file || c.dirExist(path) != c2.isDir {
+			t.Error("检查结果有误：", c2.path, c.fileExist(path), c.dirExist(path))
+		}
+	}
+
+	// 列表中只有大小写不同的名称时直接检查，如大小写不敏感的文件系统上的`DB.yaml`
+	ioutil.WriteFile(filepath.Join(dir, "DB.yaml"), nil, 0644)
+	if !c.fileExist(filepath.Join(dir, "DB.yaml")) {
+		t.Error("列表中有大小写不同的名称时应该直接检查")
+	}
+	os.Remove(filepath.Join(dir, "DB.yaml"))
+
+	// 共享的缓存需要在目录变化后失效
+	var v struct {
+		RedisYaml string
+	}
+	det := NewDetector().WithDir(dir).WithDirCache(c)
+	if err := det.Detect(&v); err == nil {
+		t.Fatal("文件不存在时应该报错")
+	}
+	ioutil.WriteFile(filepath.Join(dir, "redis.yaml"), nil, 0644)
+	if err := det.Detect(&v); err == nil {
+		t.Error("没有失效时应该使用缓存的目录列表")
+	}
+	c.Invalidate(dir + "/")
+	if err := det.Detect(&v); err != nil || v.RedisYaml != filepath.Join(dir, "redis.yaml") {
+		t.Error("失效后应该重新读取目录：", v.RedisYaml, err)
+	}
+
+	// 默认每次探测使用新的缓存
+	os.Remove(filepath.Join(dir, "redis.yaml"))
+	if err := NewDetector().WithDir(dir).Detect(&v); err == nil {
+		t.Error("默认不应该在多次探测之间共享缓存")
+	}
+}
@@ -2,33 +2,25 @@ package detector
 
 import (
 	"fmt"
-	"os"
 	"path/filepath"
-	"reflect"
-	"sort"
 	"strings"
 )
 
-type directory struct {
-	path string
-}
-
 type dirSchema struct {
-	_detector *detector
+	opts *schemaOptions
 
-	fieldTag envTag
-	field    reflect.StructField
-	fieldVal reflect.Value
+	fieldTag  envTag
+	fieldName string
 
 	// 当前目录对应的环境变量名
 	EnvPathKey string
+	// 包括别名在内的所有环境变量名
+	envKeys envKeys
 
 	// 当前目录名
 	Name string
-	// 当前目录路径
-	Path string
-	// 对应结构体中用来存储Path的value
-	pathFieldVal reflect.Value
+	// 对应结构体中用来存储Path的成员在探测结果中的下标，-1表示没有
+	pathTargetIdx int
 	// 父目录
 	ParentDir *dirSchema `json:"-"`
 	// 子目录集合
@@ -37,173 +29,173 @@ type dirSchema struct {
 	ChildrenFile []*fileSchema
 }
 
-func (this *dirSchema) detector() (err error) {
-	// 如果没有预先设置的Path
-	if this.Path == "" {
-		this.Path, err = func() (string, error) {
-			// 1. 根据当前目录对应的环境变量名
-			if this.EnvPathKey != "" {
-				if path := os.Getenv(this.EnvPathKey); path != "" {
-					if dirExist(path) {
-						return path, nil
-					} else {
-						// 如果配置了环境变量，则在出错时立即返回
-						return "", fmt.Errorf("环境变量'%s'='%s'对应的目录不存在", this.EnvPathKey, path)
-					}
+// 在父目录parentPath下探测当前目录，返回当前目录的路径，其成员的探测顺序见Schema.detect
+func (this *dirSchema) detector(state *detectState, parentPath string) (string, error) {
+	name, err := state.expand(this.Name)
+	if err != nil {
+		return "", err
+	}
+	// 默认顺序为环境变量、优先级目录、父目录、推断，见Source
+	for _, source := range state._detector.sourceOrder(this.fieldTag) {
+		switch source {
+		case Source.Env:
+			// 根据当前目录对应的环境变量名
+			if key, value, err := state.lookupEnv(this.envKeys); err != nil {
+				return "", err
+			} else if value != "" {
+				// 如果配置了环境变量，则在出错时立即返回
+				paths, err := state.envPaths(key, value, "目录", func(p string) (bool, error) {
+					return state.exists(p, true, this.fieldTag)
+				}, false)
+				if err != nil {
+					return "", err
 				}
+				return paths[0], nil
 			}
-			// 2. 根据优先级目录
-			for _, path := range this.fieldTag.Priority {
+		case Source.Priority:
+			// 根据优先级目录
+			anchorDir := state.priorityAnchor(this.fieldTag, parentPath)
+			for _, path := range this.priority() {
+				path, err := state.resolve(path, anchorDir)
+				if err != nil {
+					return "", err
+				}
 				// 目录则直接使用优先级目录作为目录尝试
-				if dirExist(path) {
+				if ok, err := state.exists(path, true, this.fieldTag); err != nil {
+					return "", err
+				} else if ok {
 					return path, nil
 				}
 			}
-			// 3. 根据父目录
+		case Source.Parent:
+			// 根据父目录
 			if this.ParentDir != nil {
-				if curPath := dirJoin(this.ParentDir.Path, this.Name); curPath != "" {
+				if curPath, err := state.join(parentPath, name, true, this.fieldTag); err != nil {
+					return "", err
+				} else if curPath != "" {
 					return curPath, nil
-				} else if this.fieldTag.Infer {
-					// 如果允许推断，则直接使用根据父目录的推断结果
-					// 如果当前目录中还有成员需要推断，仍然会继续工作
-					// 因为可以有例如Priority()、Env等途径写入可用的路径
-					return filepath.Join(this.ParentDir.Path, this.Name), nil
 				}
 			}
-			return "", fmt.Errorf("找不到%s的实际路径", this.Name)
-		}()
-		if err != nil {
-			return err
-		}
-	}
-
-	if this.pathFieldVal.CanSet() {
-		// 可能为空
-		this.pathFieldVal.SetString(this.Path)
-	}
-
-	// 处理当前目录文件
-	for i := 0; i < len(this.ChildrenFile); i++ {
-		fileSch := this.ChildrenFile[i]
-		err := fileSch.detector()
-		if this._detector.isDebug {
-			log.Println("\n" + fileSch.genDoc())
-		}
-		if err != nil {
-			if !fileSch.fieldTag.Opt {
-				return fmt.Errorf("处理%s下的文件%s出错{%s}", this.Name, fileSch.Name, err.Error())
-			} else {
-				// 该文件是可选的，则异常时移除
-				this.ChildrenFile = append(this.ChildrenFile[:i], this.ChildrenFile[i+1:]...)
-				// 因为移除了一个文件，所以要跳过本次自增
-				i--
+		case Source.Infer:
+			// 如果允许推断，则直接使用根据父目录的推断结果
+			// 如果当前目录中还有成员需要推断，仍然会继续工作
+			// 因为可以有例如Priority()、Env等途径写入可用的路径
+			if this.ParentDir != nil {
+				return filepath.Join(parentPath, name), nil
 			}
 		}
 	}
-
-	// 继续处理子目录
-	for i := 0; i < len(this.ChildrenDir); i++ {
-		dirSch := this.ChildrenDir[i]
-		err := dirSch.detector()
-		if this._detector.isDebug {
-			log.Println("\n" + dirSch.genDoc())
-		}
-		if err != nil {
-			if !dirSch.fieldTag.Opt {
-				return fmt.Errorf("处理%s的子目录%s出错{%s}", this.Name, dirSch.Name, err.Error())
-			} else {
-				// 该文件是可选的，则异常时移除
-				this.ChildrenDir = append(this.ChildrenDir[:i], this.ChildrenDir[i+1:]...)
-				// 因为移除了一个目录，所以要跳过本次自增
-				i--
-			}
-		}
+	// 在父目录中查找相近的目录名
+	suggestion := ""
+	if this.ParentDir != nil && containsSource(state._detector.sourceOrder(this.fieldTag), Source.Parent) {
+		suggestion = state.suggest([]string{parentPath}, name, nameVariants(this.fieldName, this.fieldTag, true, this.opts), true)
 	}
-	return nil
+	return "", missingf("找不到%s的实际路径%s%s", this.Name, state.danglingNote(), suggestion)
 }
 
-func (this *dirSchema) genDoc() string {
+func (this *dirSchema) genDoc(order []SourceID, parentPath string) string {
 	s := "目录搜索逻辑："
 	h1Idx := 0
 	padStr := strings.Repeat(" ", len(this.fieldTag.Priority))
-
-	if this.EnvPathKey != "" {
-		h1Idx++
-		s += fmt.Sprintf("\n%d、 %s从环境变量'%s'获取，如果目录存在立即返回。", h1Idx, padStr, this.EnvPathKey)
-	}
-
-	if len(this.fieldTag.Priority) > 0 {
-		h1Idx++
-		for i, priorityPath := range this.fieldTag.Priority {
-			s += fmt.Sprintf("\n%d.%d、从优先路径'%s'获取，如果目录存在则立即返回。", h1Idx, i+1, filepath.Join(priorityPath, this.Name))
+	for _, source := range order {
+		switch source {
+		case Source.Env:
+			if len(this.envKeys.keys) > 0 {
+				h1Idx++
+				s += fmt.Sprintf("\n%d、 %s从环境变量'%s'获取，如果目录存在立即返回。", h1Idx, padStr, strings.Join(this.envKeys.keys, "'、'"))
+			}
+		case Source.Priority:
+			if priority := this.priority(); len(priority) > 0 {
+				h1Idx++
+				for i, priorityPath := range priority {
+					s += fmt.Sprintf("\n%d.%d、从优先路径'%s'获取，如果目录存在则立即返回。", h1Idx, i+1, filepath.Join(priorityPath, this.Name))
+				}
+			}
+		case Source.Parent:
+			if this.ParentDir != nil {
+				h1Idx++
+				s += fmt.Sprintf("\n%d、 %s从父目录'%s'获取，如果目录存在则立即返回。", h1Idx, padStr, filepath.Join(parentPath, this.Name))
+			}
+		case Source.Infer:
+			if this.ParentDir != nil {
+				h1Idx++
+				s += fmt.Sprintf("\n%d、 %s推断为'%s'，不检查目录是否存在。", h1Idx, padStr, filepath.Join(parentPath, this.Name))
+			}
 		}
 	}
-
-	if this.ParentDir != nil {
-		h1Idx++
-		s += fmt.Sprintf("\n%d、 %s从父目录'%s'获取，如果目录存在则立即返回。", h1Idx, padStr, filepath.Join(this.ParentDir.Path, this.Name))
-	}
-
 	return s
 }
 
-func (this *detector) newDirSchema(v reflect.Value, parentDir *dirSchema, f *reflect.StructField) (*dirSchema, error) {
-	t := v.Type()
-	if v.Kind() == reflect.Ptr {
-		return nil, fmt.Errorf("为了防止意外的循环引用，请不要使用Ptr类型")
-	}
-
+func (this *schemaOptions) newDirSchema(spec *Spec, parentDir *dirSchema, numTargets *int) (*dirSchema, error) {
 	curDirSch := &dirSchema{
-		_detector:    this,
-		ParentDir:    parentDir,
-		fieldVal:     v,
-		ChildrenDir:  make([]*dirSchema, 0, t.NumField()),
-		ChildrenFile: make([]*fileSchema, 0, t.NumField()),
+		opts:          this,
+		ParentDir:     parentDir,
+		fieldName:     spec.Field,
+		pathTargetIdx: -1,
+		ChildrenDir:   make([]*dirSchema, 0, len(spec.Children)),
+		ChildrenFile:  make([]*fileSchema, 0, len(spec.Children)),
 	}
 
-	if f != nil {
-		curDirSch.field = *f
-		curDirSch.fieldTag = parseTag(f.Tag)
+	if parentDir != nil {
+		fieldTag, err := parseTag(spec.Tag)
+		if err != nil {
+			err.(*TagError).Field = joinFieldPath(parentDir.fieldPath(), spec.Field)
+			return nil, err
+		}
+		curDirSch.fieldTag = fieldTag
 	} else {
 		curDirSch.fieldTag = defaultDirectoryTag
+		if this.defaultTag != "" {
+			et, err := parseDefaultTag(this.defaultTag)
+			if err != nil {
+				return nil, err
+			}
+			curDirSch.fieldTag.FileExt, curDirSch.fieldTag.FileSplit = et.FileExt, et.FileSplit
+			curDirSch.fieldTag.ChildPriority = et.ChildPriority
+		}
 	}
 	curDirSch.initName()
 	curDirSch.initEnvKey()
 
-	for i := 0; i < t.NumField(); i++ {
-		f := t.Field(i)
-		fv := v.Field(i)
-		if !fv.IsValid() {
-			continue
-		}
-		switch f.Type.Kind() {
-		case reflect.Struct:
+	for _, childSpec := range spec.Children {
+		if childSpec.Dir {
 			// 迭代
-			childDirSch, err := this.newDirSchema(fv, curDirSch, &f)
+			childDirSch, err := this.newDirSchema(childSpec, curDirSch, numTargets)
 			if err != nil {
-				// log.Fatal(err)
+				return nil, err
 			}
 			curDirSch.ChildrenDir = append(curDirSch.ChildrenDir, childDirSch)
-		case reflect.String:
-			// 如果符合该目录标注的PATH字段
-			if f.Name == curDirSch.fieldTag.Path {
-				// 如果被标记为Path，则表示当前目录
-				curDirSch.pathFieldVal = fv
-			} else {
-				// 如果没有被标记为Path，则表示当前目录下的某个文件
-				fileSch, err := this.newFileSchema(fv, curDirSch, &f)
-				if err != nil {
-					// log.Fatal(err)
-				}
-				curDirSch.ChildrenFile = append(curDirSch.ChildrenFile, fileSch)
+			continue
+		}
+		targetIdx := *numTargets
+		*numTargets++
+		// 如果符合该目录标注的PATH字段
+		if childSpec.Field == curDirSch.fieldTag.Path {
+			// 如果被标记为Path，则表示当前目录
+			if childSpec.List {
+				return nil, fmt.Errorf("成员%s：目录的路径仅可使用string类型", joinFieldPath(curDirSch.fieldPath(), childSpec.Field))
+			}
+			curDirSch.pathTargetIdx = targetIdx
+		} else {
+			// 如果没有被标记为Path，则表示当前目录下的某个文件
+			fileSch, err := this.newFileSchema(childSpec, curDirSch, targetIdx)
+			if err != nil {
+				return nil, err
 			}
-		default:
-			return nil, fmt.Errorf("不支持的数据类型%s", f.Type.Name())
+			curDirSch.ChildrenFile = append(curDirSch.ChildrenFile, fileSch)
 		}
 	}
 	return curDirSch, nil
 }
 
+// 当前目录对应的成员路径，形如`Runtimes.Log`，根目录为空
+func (this *dirSchema) fieldPath() string {
+	if this.ParentDir == nil {
+		return ""
+	}
+	return joinFieldPath(this.ParentDir.fieldPath(), this.fieldName)
+}
+
 func (this *dirSchema) initName() {
 	if this.Name == "" {
 		// 1. 从tag的Name字段获取
@@ -214,35 +206,15 @@ func (this *dirSchema) initName() {
 		// 根目录另外处理
 		if this.ParentDir == nil {
 			// 根目录
-			if this._detector.envPrefix != "" {
-				this.Name = this._detector.envPrefix
+			if this.opts.envPrefix != "" {
+				this.Name = this.opts.envPrefix
 			} else {
-				// this.Name = filepath.Base(this._detector.getBaseDir())
+				// this.Name = filepath.Base(this.opts.getBaseDir())
 			}
 		}
 
 		// 2. 从字段名获取
-		switch this._detector.directoryNameParseType {
-		case NameParseType.SmartSnake:
-			sl := nameSplit(this.field.Name)
-			if len(sl) > 0 {
-				dirSplt := this._detector.dirSplit
-				if this.fieldTag.Split != "" {
-					dirSplt = this.fieldTag.Split
-				}
-				this.Name = strings.Join(sl, dirSplt)
-				if this.fieldTag.Ext != "" {
-					// 目录一般不要设Ext……
-					this.Name = this.Name + "." + this.fieldTag.Ext
-				}
-				this.Name = strings.ToLower(this.Name)
-				return
-			}
-			fallthrough
-		default:
-			this.Name = this.field.Name
-			return
-		}
+		this.Name = inferDirName(this.fieldName, this.fieldTag, this.opts.dirSplit, this.opts.directoryNameParseType)
 	}
 }
 
@@ -251,27 +223,27 @@ func (this *dirSchema) initEnvKey() {
 		// 1. 从tag的Key字段获取
 		if this.fieldTag.Key != "" {
 			this.EnvPathKey = this.fieldTag.Key
-			return
-		}
-		// 2. 根据规则`${DIR_PREFIX}_${DIR_1}(_${DIR_2}_${FILE_NAME}_${FILE_EXT})`
-		elmList := make([]string, 0, 10)
-		curDir := this
-		for curDir != nil {
-			if curDir.Name != "" {
-				elmList = append(elmList, curDir.Name)
-			}
-			curDir = curDir.ParentDir
-		}
-		if this._detector.envPrefix != "" {
-			elmList = append(elmList, this._detector.envPrefix)
+		} else {
+			// 2. 根据规则生成，默认为`${DIR_PREFIX}_${DIR_1}(_${DIR_2}_${FILE_NAME}_${FILE_EXT})`
+			this.EnvPathKey = this.opts.envKey(this.names(), false)
 		}
-		elmSort := sort.StringSlice(elmList)
-		for i := 0; i < elmSort.Len()/2; i++ {
-			elmSort.Swap(i, elmSort.Len()-i-1)
+		// 3. 加上tag中的别名
+		this.envKeys = newEnvKeys(this.EnvPathKey, this.fieldTag)
+	}
+}
+
+// 从根目录到当前目录的各级目录名，忽略空的目录名
+func (this *dirSchema) names() []string {
+	elmList := make([]string, 0, 10)
+	curDir := this
+	for curDir != nil {
+		if curDir.Name != "" {
+			elmList = append(elmList, curDir.Name)
 		}
-		this.EnvPathKey = strings.Join(elmList, "_")
-		// // log.Println(convert.MustJsonPrettyString(elmList))
-		this.EnvPathKey = strings.ToUpper(this.EnvPathKey)
-		// // log.Println(this.EnvPathKey)
+		curDir = curDir.ParentDir
+	}
+	for i := 0; i < len(elmList)/2; i++ {
+		elmList[i], elmList[len(elmList)-i-1] = elmList[len(elmList)-i-1], elmList[i]
 	}
+	return elmList
 }
@@ -0,0 +1,197 @@
+package detector
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+)
+
+// 根据路径生成环境变量名的规则。
+// path依次为前缀（如果设置了WithEnvPrefix）、各级目录名，以及文件名（isFile时），均为推断出的原始名称。
+type EnvKeyFunc func(path []string, isFile bool) string
+
+var EnvKeyStyle = struct {
+	// 与旧版本完全一致：文件名前多一个`_`，目录名中的非法字符不做处理
+	Compat EnvKeyFunc
+	// 默认，规则同Compat，但目录名中的非法字符同样会处理成`_`，如`STH_CONF__DB_YAML`
+	Snake EnvKeyFunc
+	// 各级之间统一用`__`分隔，如`STH__CONF__DB_YAML`
+	Nested EnvKeyFunc
+}{
+	Compat: compatEnvKey,
+	Snake:  snakeEnvKey,
+	Nested: nestedEnvKey,
+}
+
+func compatEnvKey(path []string, isFile bool) string {
+	if isFile {
+		// 给文件名前边多一个下划线
+		elmList := append(append(make([]string, 0, len(path)+1), path[:len(path)-1]...), "", path[len(path)-1])
+		return toEnvKey(strings.ToUpper(strings.Join(elmList, "_")))
+	}
+	return strings.ToUpper(strings.Join(path, "_"))
+}
+
+func snakeEnvKey(path []string, isFile bool) string {
+	return toEnvKey(compatEnvKey(path, isFile))
+}
+
+func nestedEnvKey(path []string, isFile bool) string {
+	elmList := make([]string, 0, len(path))
+	for _, elm := range path {
+		elmList = append(elmList, toEnvKey(strings.ToUpper(elm)))
+	}
+	return strings.Join(elmList, "__")
+}
+
+// 内置的规则使用固定的引用，以便相同配置的Detector之间共享编译缓存
+var builtinEnvKeyStyles = []*EnvKeyFunc{
+	&EnvKeyStyle.Compat,
+	&EnvKeyStyle.Snake,
+	&EnvKeyStyle.Nested,
+}
+
+// 函数不可比较，所以schemaOptions中保存其引用，nil视为默认的EnvKeyStyle.Snake。
+// 自定义的规则每次设置都会生成新的引用，其编译结果只缓存在Detector上，见detector.compileCache。
+func envKeyStyleRef(style EnvKeyFunc) *EnvKeyFunc {
+	if style == nil {
+		return &EnvKeyStyle.Snake
+	}
+	p := reflect.ValueOf(style).Pointer()
+	for _, ref := range builtinEnvKeyStyles {
+		if reflect.ValueOf(*ref).Pointer() == p {
+			return ref
+		}
+	}
+	return &style
+}
+
+func isBuiltinEnvKeyStyle(ref *EnvKeyFunc) bool {
+	for _, builtin := range builtinEnvKeyStyles {
+		if builtin == ref {
+			return true
+		}
+	}
+	return false
+}
+
+// 根据配置的规则生成环境变量名
+func (this *schemaOptions) envKey(path []string, isFile bool) string {
+	if this.envPrefix != "" {
+		path = append([]string{this.envPrefix}, path...)
+	}
+	if len(path) == 0 {
+		return ""
+	}
+	key := (*this.envKeyStyle)(path, isFile)
+	if this.envKeyStyle != &EnvKeyStyle.Compat {
+		// 因为环境变量只能使用数字字母下划线，所以统一处理掉不合法的命名。
+		key = toEnvKey(key)
+		if strings.Trim(key, "_") == "" {
+			// 名称中没有任何字母数字（如`~`、`-`），处理后只剩`_`，可能与shell设置的`$_`等冲突，不使用环境变量
+			return ""
+		}
+	}
+	return key
+}
+
+// 成员可以使用的环境变量名
+type envKeys struct {
+	// 按优先级排列，第一个为主变量名
+	keys []string
+	// 已废弃的变量名
+	deprecated map[string]bool
+}
+
+func newEnvKeys(primary string, tag envTag) envKeys {
+	if primary == "" || primary == "-" {
+		return envKeys{}
+	}
+	res := envKeys{keys: []string{primary}}
+	seen := map[string]bool{primary: true}
+	for _, key := range append(append([]string{}, tag.KeyAliases...), tag.Deprecated...) {
+		if !seen[key] {
+			seen[key] = true
+			res.keys = append(res.keys, key)
+		}
+	}
+	if len(tag.Deprecated) > 0 {
+		res.deprecated = make(map[string]bool, len(tag.Deprecated))
+		for _, key := range tag.Deprecated {
+			res.deprecated[key] = true
+		}
+	}
+	return res
+}
+
+// 推荐使用的变量名，即第一个未废弃的变量名
+func (this envKeys) replacement() string {
+	for _, key := range this.keys {
+		if !this.deprecated[key] {
+			return key
+		}
+	}
+	return this.keys[0]
+}
+
+// 按顺序读取环境变量，第一个设置了的生效。
+// 多个变量名设置了不同的值时报错。
+func (this envKeys) lookup() (key, value string, err error) {
+	for _, k := range this.keys {
+		v := os.Getenv(k)
+		if v == "" {
+			continue
+		}
+		if key == "" {
+			key, value = k, v
+		} else if v != value {
+			return "", "", fmt.Errorf("环境变量'%s'='%s'与'%s'='%s'不一致", key, value, k, v)
+		}
+	}
+	return key, value, nil
+}
+
+// 读取环境变量，使用了废弃的变量名时输出警告，见envKeys.lookup
+func (this *detectState) lookupEnv(keys envKeys) (key, value string, err error) {
+	if key, value, err = keys.lookup(); key != "" && keys.deprecated[key] {
+		this.logf("[WARN]环境变量'%s'已废弃，请使用'%s'", key, keys.replacement())
+	}
+	return key, value, err
+}
+
+// 环境变量的值可以是os.PathListSeparator分隔的多个路径，按顺序返回存在的路径，all为false时只返回第一个。
+// 所有路径都不存在时报错。
+func (this *detectState) envPaths(key, value, kind string, exist func(string) (bool, error), all bool) ([]string, error) {
+	list := make([]string, 0, 1)
+	res := make([]string, 0, 1)
+	seen := make(map[string]bool)
+	for _, path := range filepath.SplitList(value) {
+		// 相对路径以工作目录为起点
+		path, err := this.resolve(path, this.baseDir)
+		if err != nil {
+			return nil, fmt.Errorf("环境变量'%s'：%s", key, err.Error())
+		}
+		if path == "" || seen[path] {
+			continue
+		}
+		seen[path] = true
+		list = append(list, path)
+		if ok, err := exist(path); err != nil {
+			return nil, fmt.Errorf("环境变量'%s'：%s", key, err.Error())
+		} else if ok {
+			res = append(res, path)
+			if !all {
+				break
+			}
+		}
+	}
+	if len(res) > 0 {
+		return res, nil
+	}
+	if len(list) > 1 {
+		return nil, missingf("环境变量'%s'中的%s都不存在：'%s'%s", key, kind, strings.Join(list, "'、'"), this.danglingNote())
+	}
+	return nil, missingf("环境变量'%s'='%s'对应的%s不存在%s", key, value, kind, this.danglingNote())
+}
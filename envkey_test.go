@@ -0,0 +1,215 @@
+package detector
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type envKeyLayout struct {
+	DitDir struct {
+		DBYaml string
+	} `pd:"Name(dit-dir)"`
+	Conf struct {
+		DBYaml string
+	}
+}
+
+func TestEnvKeyStyle(t *testing.T) {
+	cases := []struct {
+		style EnvKeyFunc
+		keys  []string
+	}{
+		{EnvKeyStyle.Snake, []string{"DIT_DIR", "DIT_DIR__DB_YAML", "CONF", "CONF__DB_YAML"}},
+		{EnvKeyStyle.Compat, []string{"DIT-DIR", "DIT_DIR__DB_YAML", "CONF", "CONF__DB_YAML"}},
+		{EnvKeyStyle.Nested, []string{"DIT_DIR", "DIT_DIR__DB_YAML", "CONF", "CONF__DB_YAML"}},
+		{func(path []string, isFile bool) string {
+			return strings.Join(path, ".")
+		}, []string{"dit_dir", "dit_dir_db_yaml", "conf", "conf_db_yaml"}},
+	}
+	for i, c := range cases {
+		sch, err := NewDetector().WithEnvKeyStyle(c.style).Compile(reflect.TypeOf(envKeyLayout{}))
+		if err != nil {
+			t.Fatal(err)
+		}
+		keys := make([]string, 0, len(sch.nodes))
+		for _, n := range sch.nodes {
+			keys = append(keys, n.envKey)
+		}
+		if !reflect.DeepEqual(keys, c.keys) {
+			t.Errorf("case %d: %v != %v", i, keys, c.keys)
+		}
+	}
+}
+
+func TestEnvKeyStyleCache(t *testing.T) {
+	// nil视为默认的规则
+	sch, err := NewDetector().WithEnvKeyStyle(nil).Compile(reflect.TypeOf(envKeyLayout{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key := sch.nodes[0].envKey; key != "DIT_DIR" {
+		t.Error(key)
+	}
+
+	// 自定义的规则不写入全局缓存
+	custom := func(path []string, isFile bool) string {
+		return strings.Join(path, "_")
+	}
+	det := NewDetector().WithEnvKeyStyle(custom).(*detector)
+	if _, err = det.Compile(reflect.TypeOf(envKeyLayout{})); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := schemaCache.Load(schemaKey{src: reflect.TypeOf(envKeyLayout{}), opts: det.schemaOptions}); ok {
+		t.Error("自定义规则的编译结果不应该写入全局缓存")
+	}
+	if _, ok := det.schemas.Load(schemaKey{src: reflect.TypeOf(envKeyLayout{}), opts: det.schemaOptions}); !ok {
+		t.Error("自定义规则的编译结果应该缓存在Detector上")
+	}
+}
+
+func TestEnvKeyWithoutAlnum(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	os.MkdirAll(filepath.Join(dir, "~"), 0755)
+	os.MkdirAll(filepath.Join(dir, "-"), 0755)
+	// shell总是会设置`$_`
+	if old, ok := os.LookupEnv("_"); ok {
+		defer os.Setenv("_", old)
+	} else {
+		defer os.Unsetenv("_")
+	}
+	os.Setenv("_", "/usr/local/go/bin/go")
+
+	var v struct {
+		Home struct {
+			Path string
+		} `pd:"Name($~)"`
+		Dash struct {
+			Path string
+		} `pd:"Name(-)"`
+	}
+	sch, err := NewDetector().Compile(reflect.TypeOf(v))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, n := range sch.nodes {
+		if n.envKey != "" {
+			t.Error("没有字母数字的名称不应该生成环境变量名：", n.envKey)
+		}
+	}
+	if err := NewDetector().WithDir(dir).Detect(&v); err != nil || v.Home.Path != filepath.Join(dir, "~") || v.Dash.Path != filepath.Join(dir, "-") {
+		t.Error("不应该使用环境变量`_`：", v.Home.Path, v.Dash.Path, err)
+	}
+}
+
+func TestEnvKeyStylePrefix(t *testing.T) {
+	sch, err := NewDetector().WithEnvPrefix("app").WithEnvKeyStyle(EnvKeyStyle.Nested).Compile(reflect.TypeOf(envKeyLayout{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key := sch.nodes[3].envKey; key != "APP__CONF__DB_YAML" {
+		t.Error(key)
+	}
+}
+
+func TestEnvKeyAliases(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	ioutil.WriteFile(filepath.Join(dir, "db.yaml"), nil, 0644)
+	ioutil.WriteFile(filepath.Join(dir, "old.yaml"), nil, 0644)
+
+	buf := &bytes.Buffer{}
+	SetLogger(buf, "", 0)
+	defer SetLogger(ioutil.Discard, "", 0)
+
+	type layout struct {
+		DBYaml string `pd:"Key(PD_NEW_DB|PD_OLD_DB);Deprecated(PD_OLD_DB)"`
+	}
+	detect := func() (string, error) {
+		var v layout
+		err := NewDetector().WithDir(dir).Detect(&v)
+		return v.DBYaml, err
+	}
+
+	os.Setenv("PD_OLD_DB", filepath.Join(dir, "old.yaml"))
+	defer os.Unsetenv("PD_OLD_DB")
+	if path, err := detect(); err != nil || path != filepath.Join(dir, "old.yaml") {
+		t.Error("应该使用废弃的环境变量：", path, err)
+	}
+	if !strings.Contains(buf.String(), "'PD_OLD_DB'已废弃，请使用'PD_NEW_DB'") {
+		t.Error("应该输出废弃警告：", buf.String())
+	}
+
+	os.Setenv("PD_NEW_DB", filepath.Join(dir, "db.yaml"))
+	defer os.Unsetenv("PD_NEW_DB")
+	if _, err := detect(); err == nil || !strings.Contains(err.Error(), "不一致") {
+		t.Error("别名的值不一致时应该报错：", err)
+	}
+
+	os.Setenv("PD_OLD_DB", filepath.Join(dir, "db.yaml"))
+	if path, err := detect(); err != nil || path != filepath.Join(dir, "db.yaml") {
+		t.Error("别名的值一致时应该使用第一个：", path, err)
+	}
+}
+
+func TestEnvKeyAliasCollision(t *testing.T) {
+	_, err := NewDetector().Compile(reflect.TypeOf(struct {
+		DBYaml   string `pd:"Deprecated(DB_FILE)"`
+		DBConfig string `pd:"Key(DB_FILE)"`
+	}{}))
+	if _, ok := err.(*CollisionError); !ok {
+		t.Error("别名与其他成员的环境变量名冲突时应该报错：", err)
+	}
+}
+
+func TestEnvPathList(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	os.MkdirAll(filepath.Join(dir, "conf"), 0755)
+	ioutil.WriteFile(filepath.Join(dir, "a.yaml"), nil, 0644)
+	ioutil.WriteFile(filepath.Join(dir, "b.yaml"), nil, 0644)
+	missing := filepath.Join(dir, "missing")
+	list := func(paths ...string) string {
+		return strings.Join(paths, string(os.PathListSeparator))
+	}
+
+	var v struct {
+		Conf struct {
+			Path string
+		} `pd:"Key(PD_LIST_CONF)"`
+		Plugins []string `pd:"Key(PD_LIST_PLUGINS)"`
+	}
+	os.Setenv("PD_LIST_CONF", list(missing, filepath.Join(dir, "conf"), dir))
+	defer os.Unsetenv("PD_LIST_CONF")
+	os.Setenv("PD_LIST_PLUGINS", list(filepath.Join(dir, "a.yaml"), missing, filepath.Join(dir, "b.yaml")))
+	defer os.Unsetenv("PD_LIST_PLUGINS")
+	if err := NewDetector().WithDir(dir).Detect(&v); err != nil {
+		t.Fatal(err)
+	}
+	if v.Conf.Path != filepath.Join(dir, "conf") {
+		t.Error("应该使用第一个存在的目录：", v.Conf.Path)
+	}
+	if !reflect.DeepEqual(v.Plugins, []string{filepath.Join(dir, "a.yaml"), filepath.Join(dir, "b.yaml")}) {
+		t.Error("应该写入所有存在的文件：", v.Plugins)
+	}
+
+	os.Setenv("PD_LIST_CONF", list(missing, missing+"2"))
+	err = NewDetector().WithDir(dir).Detect(&v)
+	if err == nil || !strings.Contains(err.Error(), "'"+missing+"'、'"+missing+"2'") {
+		t.Error("应该列出所有不存在的目录：", err)
+	}
+}
@@ -0,0 +1,184 @@
+package detector
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// 路径中可以使用的内置变量，形如`{exe_dir}`，参数为当前使用的工作目录
+var builtinVars = map[string]func(baseDir string) (string, error){
+	// 可执行文件所在的目录
+	"exe_dir": func(string) (string, error) {
+		return filepath.Abs(filepath.Dir(os.Args[0]))
+	},
+	// 当前使用的工作目录
+	"base_dir": func(baseDir string) (string, error) {
+		if baseDir == "" {
+			return "", fmt.Errorf("此处还没有确定工作目录，不能使用{base_dir}")
+		}
+		return baseDir, nil
+	},
+	// 可执行文件名，不含后缀
+	"app": func(string) (string, error) {
+		name := filepath.Base(os.Args[0])
+		return strings.TrimSuffix(name, filepath.Ext(name)), nil
+	},
+	"hostname": func(string) (string, error) {
+		return os.Hostname()
+	},
+}
+
+// 展开路径时可以使用的变量
+type expandVars struct {
+	// 当前使用的工作目录，为空表示还没有确定
+	baseDir string
+	// 引用其他成员的探测结果，name形如`Runtimes.Path`，为nil表示不能引用
+	ref func(name string) (string, error)
+	// 可以引用的成员，与其同名的`${Name}`看做对成员的引用，见Schema.refIndex
+	refs map[string]int
+}
+
+// 展开路径中的`~`、`$VAR`、`${VAR}`、`${Field.Path}`以及内置变量，`$$`、`$~`、`{{`分别表示`$`、`~`、`{`本身。
+// 未定义的变量会报错，而不是展开成空字符串。
+func expandPath(s string, vars expandVars) (string, error) {
+	if !strings.ContainsAny(s, "~${") {
+		return s, nil
+	}
+	res := &strings.Builder{}
+	i := 0
+	if s[0] == '~' && (len(s) == 1 || os.IsPathSeparator(s[1])) {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", fmt.Errorf("展开'%s'出错{%s}", s, err.Error())
+		}
+		res.WriteString(home)
+		i = 1
+	}
+	for i < len(s) {
+		switch c := s[i]; {
+		case c == '$' && i+1 < len(s) && s[i+1] == '$':
+			res.WriteByte('$')
+			i += 2
+		case c == '$' && i+1 < len(s) && s[i+1] == '~':
+			res.WriteByte('~')
+			i += 2
+		case c == '{' && i+1 < len(s) && s[i+1] == '{':
+			res.WriteByte('{')
+			i += 2
+		case c == '$':
+			name, end, braced := "", i+1, false
+			if end < len(s) && s[end] == '{' {
+				braced = true
+				close := strings.IndexByte(s[end:], '}')
+				if close < 0 {
+					return "", fmt.Errorf("展开'%s'出错{缺少`}`}", s)
+				}
+				name, end = s[end+1:end+close], end+close+1
+			} else {
+				for end < len(s) && isVarChar(s[end]) {
+					end++
+				}
+				name = s[i+1 : end]
+			}
+			if name == "" {
+				return "", fmt.Errorf("展开'%s'出错{`$`后需要变量名，`$`本身请使用`$$`}", s)
+			}
+			if braced && isFieldRef(name, vars.refs) {
+				// 引用其他成员的探测结果
+				if vars.ref == nil {
+					return "", fmt.Errorf("展开'%s'出错{此处不能引用成员%s}", s, name)
+				}
+				v, err := vars.ref(name)
+				if err != nil {
+					return "", fmt.Errorf("展开'%s'出错{%s}", s, err.Error())
+				}
+				res.WriteString(v)
+				i = end
+				continue
+			}
+			v, ok := os.LookupEnv(name)
+			if !ok {
+				return "", fmt.Errorf("展开'%s'出错{未定义的环境变量'%s'}", s, name)
+			}
+			res.WriteString(v)
+			i = end
+		case c == '{':
+			close := strings.IndexByte(s[i:], '}')
+			name := ""
+			if close > 0 {
+				name = s[i+1 : i+close]
+			}
+			if name == "" || strings.IndexFunc(name, func(r rune) bool { return r > 0x7f || !isVarChar(byte(r)) }) >= 0 {
+				// 不是变量，原样保留
+				res.WriteByte(c)
+				i++
+				continue
+			}
+			fn, ok := builtinVars[name]
+			if !ok {
+				return "", fmt.Errorf("展开'%s'出错{未知的内置变量{%s}}", s, name)
+			}
+			v, err := fn(vars.baseDir)
+			if err != nil {
+				return "", fmt.Errorf("展开'%s'出错{%s}", s, err.Error())
+			}
+			res.WriteString(v)
+			i += close + 1
+		default:
+			res.WriteByte(c)
+			i++
+		}
+	}
+	return res.String(), nil
+}
+
+// 转义s中会被expandPath展开的字符，使展开后与s一致，用于写入实际的名称，如`{app}.txt`写作`{{app}.txt`
+func escapeVars(s string) string {
+	s = strings.NewReplacer("$", "$$", "{", "{{").Replace(s)
+	if strings.HasPrefix(s, "~") {
+		s = "$" + s
+	}
+	return s
+}
+
+func isVarChar(c byte) bool {
+	return c == '_' || '0' <= c && c <= '9' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z'
+}
+
+// 环境变量名中不会出现`.`，所以`${A.B}`总是看做对成员的引用；
+// 不带`.`时，与refs中的成员（如顶层目录`${Conf}`、顶层文件`${InferFile}`）同名的看做对成员的引用，否则是环境变量
+func isFieldRef(name string, refs map[string]int) bool {
+	if strings.Contains(name, ".") {
+		return true
+	}
+	_, ok := refs[name]
+	return ok
+}
+
+// 列出s中引用的所有成员，与expandPath的规则一致
+func fieldRefs(s string, refs map[string]int) []string {
+	res := make([]string, 0)
+	for i := 0; i < len(s); i++ {
+		if s[i] != '$' || i+1 >= len(s) {
+			continue
+		}
+		if s[i+1] == '$' {
+			i++
+			continue
+		}
+		if s[i+1] != '{' {
+			continue
+		}
+		end := strings.IndexByte(s[i+1:], '}')
+		if end < 0 {
+			break
+		}
+		if name := s[i+2 : i+1+end]; isFieldRef(name, refs) {
+			res = append(res, name)
+		}
+		i += end + 1
+	}
+	return res
+}
@@ -0,0 +1,80 @@
+package detector
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestExpandPath(t *testing.T) {
+	os.Setenv("PD_EXPAND", "/opt")
+	defer os.Unsetenv("PD_EXPAND")
+	home, _ := os.UserHomeDir()
+	host, _ := os.Hostname()
+
+	for s, exp := range map[string]string{
+		"/run/conf":             "/run/conf",
+		"~/conf":                filepath.Join(home, "conf"),
+		"/a~b":                  "/a~b",
+		"$PD_EXPAND/conf":       "/opt/conf",
+		"${PD_EXPAND}_x":        "/opt_x",
+		"$$PD_EXPAND":           "$PD_EXPAND",
+		"{base_dir}/{hostname}": "/base/" + host,
+		"/a/{not var}/{}":       "/a/{not var}/{}",
+		"{{app}.txt":            "{app}.txt",
+		"$~":                    "~",
+		"$~/conf":               "~/conf",
+	} {
+		act, err := expandPath(s, expandVars{baseDir: "/base"})
+		if err != nil || act != exp {
+			t.Errorf("%s：Exp(%s)==Act(%s) %v", s, exp, act, err)
+		}
+	}
+
+	for _, name := range []string{"price$x.txt", "{app}.txt", "~", "~/a{b}$$"} {
+		act, err := expandPath(escapeVars(name), expandVars{baseDir: "/base"})
+		if err != nil || act != name {
+			t.Errorf("escapeVars(%q)无法还原：%q %v", name, act, err)
+		}
+	}
+
+	for s, reason := range map[string]string{
+		"$PD_UNDEFINED/conf": "未定义的环境变量'PD_UNDEFINED'",
+		"${PD_EXPAND":        "缺少`}`",
+		"/a/$":               "`$`后需要变量名",
+		"{unknown}":          "未知的内置变量{unknown}",
+		"{base_dir}":         "不能使用{base_dir}",
+	} {
+		if _, err := expandPath(s, expandVars{}); err == nil || !strings.Contains(err.Error(), reason) {
+			t.Errorf("%s：应该报错%s，实际为%v", s, reason, err)
+		}
+	}
+}
+
+func TestExpandDetect(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	os.MkdirAll(filepath.Join(dir, "run"), 0755)
+	ioutil.WriteFile(filepath.Join(dir, "run", "db.yaml"), nil, 0644)
+	os.Setenv("PD_EXPAND_DIR", dir)
+	defer os.Unsetenv("PD_EXPAND_DIR")
+
+	var v struct {
+		DBYaml string `pd:"Priority({base_dir}/run)"`
+	}
+	if err := NewDetector().WithDir("$PD_EXPAND_DIR").Detect(&v); err != nil || v.DBYaml != filepath.Join(dir, "run", "db.yaml") {
+		t.Error("应该展开WithDir和Priority中的变量：", v.DBYaml, err)
+	}
+
+	var bad struct {
+		DBYaml string `pd:"Priority($PD_UNDEFINED/run)"`
+	}
+	if err := NewDetector().WithDir(dir).Detect(&bad); err == nil || !strings.Contains(err.Error(), "PD_UNDEFINED") {
+		t.Error("未定义的变量应该报错：", err)
+	}
+}
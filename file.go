@@ -2,70 +2,100 @@ package detector
 
 import (
 	"fmt"
-	"os"
 	"path/filepath"
-	"reflect"
-	"sort"
 	"strings"
 )
 
 type fileSchema struct {
-	_detector *detector
+	opts *schemaOptions
 
-	fieldTag envTag
-	field    reflect.StructField
-	val      reflect.Value
+	fieldTag  envTag
+	fieldName string
+	// 对应结构体中用来存储路径的成员在探测结果中的下标
+	targetIdx int
+	// 是否是[]string成员
+	list bool
 
 	// 期望的文件名
 	Name string
-	// 文件的实际路径
-	Path string
 	// 文件所属的目录
 	ParentDir *dirSchema `json:"-"`
 
 	// 当前文件路径对应的环境变量名
 	EnvPathKey string
+	// 包括别名在内的所有环境变量名
+	envKeys envKeys
 }
 
-func (this *fileSchema) detector() (err error) {
-	// 如果没有预先设置的Path
-	if this.Path == "" {
-		this.Path, err = func() (string, error) {
-			// 1. 根据当前目录对应的环境变量名
-			if path := os.Getenv(this.EnvPathKey); path != "" {
-				if fileExist(path) {
-					return path, nil
-				} else {
-					// 如果配置了环境变量，则在出错时立即返回
-					return "", fmt.Errorf("环境变量'%s'='%s'对应的文件不存在", this.EnvPathKey, path)
-				}
+// 在父目录parentPath下探测当前文件，[]string成员可能有多个路径
+func (this *fileSchema) detector(state *detectState, parentPath string) ([]string, error) {
+	name, err := state.expand(this.Name)
+	if err != nil {
+		return nil, err
+	}
+	// 默认顺序为环境变量、优先级目录、父目录、推断，见Source
+	for _, source := range state._detector.sourceOrder(this.fieldTag) {
+		switch source {
+		case Source.Env:
+			// 根据当前文件对应的环境变量名
+			if key, value, err := state.lookupEnv(this.envKeys); err != nil {
+				return nil, err
+			} else if value != "" {
+				// 如果配置了环境变量，则在出错时立即返回
+				// []string成员会写入所有存在的路径
+				return state.envPaths(key, value, "文件", func(p string) (bool, error) {
+					return state.exists(p, false, this.fieldTag)
+				}, this.list)
 			}
-
-			// 2. 根据优先级目录
-			for _, path := range this.fieldTag.Priority {
-				if curPath := fileJoin(path, this.Name); curPath != "" {
-					return curPath, nil
+		case Source.Priority:
+			// 根据优先级目录
+			anchorDir := state.priorityAnchor(this.fieldTag, parentPath)
+			for _, path := range this.priority() {
+				path, err := state.resolve(path, anchorDir)
+				if err != nil {
+					return nil, err
+				}
+				if curPath, err := state.join(path, name, false, this.fieldTag); err != nil {
+					return nil, err
+				} else if curPath != "" {
+					return []string{curPath}, nil
 				}
 			}
-			// 3. 根据父目录
+		case Source.Parent:
+			// 根据父目录
 			if this.ParentDir != nil {
-				if curPath := fileJoin(this.ParentDir.Path, this.Name); curPath != "" {
-					return curPath, nil
-				} else if this.fieldTag.Infer {
-					// 如果允许推断，则直接使用根据父目录的推断结果
-					return filepath.Join(this.ParentDir.Path, this.Name), nil
+				if curPath, err := state.join(parentPath, name, false, this.fieldTag); err != nil {
+					return nil, err
+				} else if curPath != "" {
+					return []string{curPath}, nil
 				}
 			}
-			return "", fmt.Errorf("找不到%s的实际路径", this.Name)
-		}()
-		if err != nil {
-			return err
+		case Source.Infer:
+			// 如果允许推断，则直接使用根据父目录的推断结果
+			if this.ParentDir != nil {
+				return []string{filepath.Join(parentPath, name)}, nil
+			}
 		}
 	}
+	return nil, missingf("找不到%s的实际路径%s%s", this.Name, state.danglingNote(), this.suggest(state, parentPath, name))
+}
 
-	this.val.SetString(this.Path)
-
-	return nil
+// 在检查过的父目录及优先级目录中查找相近的文件名
+func (this *fileSchema) suggest(state *detectState, parentPath, name string) string {
+	order := state._detector.sourceOrder(this.fieldTag)
+	dirs := make([]string, 0, len(this.priority())+1)
+	if this.ParentDir != nil && containsSource(order, Source.Parent) {
+		dirs = append(dirs, parentPath)
+	}
+	if containsSource(order, Source.Priority) {
+		anchorDir := state.priorityAnchor(this.fieldTag, parentPath)
+		for _, path := range this.priority() {
+			if path, err := state.resolve(path, anchorDir); err == nil {
+				dirs = append(dirs, path)
+			}
+		}
+	}
+	return state.suggest(dirs, name, nameVariants(this.fieldName, this.fieldTag, false, this.opts), false)
 }
 
 func (this *fileSchema) initName() {
@@ -76,27 +106,7 @@ func (this *fileSchema) initName() {
 			return
 		}
 		// 2. 从字段名获取
-		switch this._detector.fileNameParseType {
-		case NameParseType.SmartSnake:
-			sl := nameSplit(this.field.Name)
-			if len(sl) > 0 {
-				split := this._detector.fileSplit
-				if this.fieldTag.Split != "" {
-					split = this.fieldTag.Split
-				}
-				this.Name = strings.Join(sl, split)
-				this.Name = strings.ToLower(this.Name)
-				if this.fieldTag.Ext != "" {
-					// 扩展名总是用.做分隔符
-					this.Name = this.Name + "." + this.fieldTag.Ext
-				}
-				return
-			}
-			fallthrough
-		default:
-			this.Name = this.field.Name
-			return
-		}
+		this.Name = inferFileName(this.fieldName, this.fieldTag, this.opts.fileSplit, this.opts.fileNameParseType)
 	}
 }
 
@@ -105,73 +115,81 @@ func (this *fileSchema) initEnvKey() {
 		// 1. 从tag的Key字段获取
 		if this.fieldTag.Key != "" {
 			this.EnvPathKey = this.fieldTag.Key
-			return
-		}
-
-		// 2. 根据规则`${DIR_PREFIX}_${DIR_1}(_${DIR_2}_${FILE_NAME}_${FILE_EXT})`
-		elmList := make([]string, 0, 10)
-		// 把目录名先拼好，文件名最后弄
-		curDir := this.ParentDir
-		for curDir != nil {
-			if curDir.Name != "" {
-				elmList = append(elmList, curDir.Name)
+		} else {
+			// 2. 根据规则生成，默认为`${DIR_PREFIX}_${DIR_1}(_${DIR_2}_${FILE_NAME}_${FILE_EXT})`
+			elmList := make([]string, 0, 10)
+			if this.ParentDir != nil {
+				elmList = append(elmList, this.ParentDir.names()...)
 			}
-			curDir = curDir.ParentDir
-		}
-		if this._detector.envPrefix != "" {
-			elmList = append(elmList, this._detector.envPrefix)
-		}
-		elmSort := sort.StringSlice(elmList)
-		for i := 0; i < elmSort.Len()/2; i++ {
-			elmSort.Swap(i, elmSort.Len()-i-1)
+			elmList = append(elmList, this.Name)
+			this.EnvPathKey = this.opts.envKey(elmList, true)
 		}
-
-		// 给文件名前边多一个下划线
-		elmList = append(elmList, "", this.Name)
-		this.EnvPathKey = strings.Join(elmList, "_")
-		// // log.Printf("%+v", elmList)
-		this.EnvPathKey = strings.ToUpper(this.EnvPathKey)
-		// 因为环境变量只能使用数字字母下划线，所以统一处理掉不合法的命名。
-		this.EnvPathKey = toEnvKey(this.EnvPathKey)
-		// // log.Println(convert.MustJsonPrettyString(elmList), this.EnvPathKey)
+		// 3. 加上tag中的别名
+		this.envKeys = newEnvKeys(this.EnvPathKey, this.fieldTag)
 	}
 }
 
-func (this *fileSchema) genDoc() string {
+func (this *fileSchema) genDoc(order []SourceID, parentPath string) string {
 	s := "路径搜索逻辑："
 	h1Idx := 0
 	padStr := strings.Repeat(" ", len(this.fieldTag.Priority))
-	if this.EnvPathKey != "" {
-		h1Idx++
-		s += fmt.Sprintf("\n%d、 %s从环境变量'%s'获取，如果文件存在立即返回。", h1Idx, padStr, this.EnvPathKey)
-	}
-	if len(this.fieldTag.Priority) > 0 {
-		h1Idx++
-		for i, priorityPath := range this.fieldTag.Priority {
-			s += fmt.Sprintf("\n%d.%d、从优先路径'%s'获取，如果文件存在则立即返回。", h1Idx, i+1, filepath.Join(priorityPath, this.Name))
+	for _, source := range order {
+		switch source {
+		case Source.Env:
+			if len(this.envKeys.keys) > 0 {
+				h1Idx++
+				s += fmt.Sprintf("\n%d、 %s从环境变量'%s'获取，如果文件存在立即返回。", h1Idx, padStr, strings.Join(this.envKeys.keys, "'、'"))
+			}
+		case Source.Priority:
+			if priority := this.priority(); len(priority) > 0 {
+				h1Idx++
+				for i, priorityPath := range priority {
+					s += fmt.Sprintf("\n%d.%d、从优先路径'%s'获取，如果文件存在则立即返回。", h1Idx, i+1, filepath.Join(priorityPath, this.Name))
+				}
+			}
+		case Source.Parent:
+			if this.ParentDir != nil {
+				h1Idx++
+				s += fmt.Sprintf("\n%d、 %s从父目录'%s'获取，如果文件存在则立即返回。", h1Idx, padStr, filepath.Join(parentPath, this.Name))
+			}
+		case Source.Infer:
+			if this.ParentDir != nil {
+				h1Idx++
+				s += fmt.Sprintf("\n%d、 %s推断为'%s'，不检查文件是否存在。", h1Idx, padStr, filepath.Join(parentPath, this.Name))
+			}
 		}
 	}
-
-	if this.ParentDir != nil {
-		h1Idx++
-		s += fmt.Sprintf("\n%d、 %s从父目录'%s'获取，如果文件存在则立即返回。", h1Idx, padStr, filepath.Join(this.ParentDir.Path, this.Name))
-	}
-
 	return s
 }
 
-func (this *detector) newFileSchema(v reflect.Value, parentDir *dirSchema, f *reflect.StructField) (*fileSchema, error) {
-	if v.Kind() != reflect.String {
+func (this *schemaOptions) newFileSchema(spec *Spec, parentDir *dirSchema, targetIdx int) (*fileSchema, error) {
+	if spec.Dir {
 		return nil, fmt.Errorf("指向文件路径仅可使用string类型")
 	}
 	fs := &fileSchema{
-		_detector: this,
-		val:       v,
+		opts:      this,
+		targetIdx: targetIdx,
+		list:      spec.List,
 		ParentDir: parentDir,
+		fieldName: spec.Field,
 	}
-	if f != nil {
-		fs.field = *f
-		fs.fieldTag = parseTag(f.Tag)
+	if parentDir != nil {
+		fieldTag, err := parseTag(spec.Tag)
+		if err != nil {
+			err.(*TagError).Field = joinFieldPath(parentDir.fieldPath(), spec.Field)
+			return nil, err
+		}
+		if name := cascadeTagName(fieldTag); name != "" {
+			return nil, fmt.Errorf("成员%s：%s仅对目录有效", joinFieldPath(parentDir.fieldPath(), spec.Field), name)
+		}
+		// 继承上级目录的配置
+		if fieldTag.Ext == "" {
+			fieldTag.Ext = parentDir.fileExt()
+		}
+		if fieldTag.Split == "" {
+			fieldTag.Split = parentDir.fileSplit()
+		}
+		fs.fieldTag = fieldTag
 	} else {
 		fs.fieldTag = defaultFileTag
 	}
@@ -0,0 +1,308 @@
+package detector
+
+import (
+	"fmt"
+	"go/format"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// 根据已有的目录树反向生成对应的结构体
+type Generator interface {
+	// 扫描目录并生成结构体的源码（已经过gofmt）
+	Generate(dir string) ([]byte, error)
+	// 生成代码的包名，默认为`main`
+	WithPackage(pkg string) Generator
+	// 生成的结构体名称，默认为`Layout`
+	WithTypeName(name string) Generator
+	// 与Detector.WithFileSplit保持一致，默认为`.`
+	WithFileSplit(split string) Generator
+	// 是否包含以`.`开头的隐藏文件/目录，默认不包含
+	WithHidden(hidden bool) Generator
+}
+
+func NewGenerator() Generator {
+	return &generator{
+		pkg:      "main",
+		typeName: "Layout",
+
+		dirSplit:               "",
+		directoryNameParseType: NameParseType.SmartSnake,
+
+		fileSplit:         ".",
+		fileNameParseType: NameParseType.SmartSnake,
+	}
+}
+
+type generator struct {
+	pkg      string
+	typeName string
+	hidden   bool
+
+	dirSplit               string
+	directoryNameParseType NameParseTypeID
+
+	fileSplit         string
+	fileNameParseType NameParseTypeID
+}
+
+func (this *generator) WithPackage(pkg string) Generator {
+	this.pkg = pkg
+	return this
+}
+
+func (this *generator) WithTypeName(name string) Generator {
+	this.typeName = name
+	return this
+}
+
+func (this *generator) WithFileSplit(split string) Generator {
+	this.fileSplit = split
+	return this
+}
+
+func (this *generator) WithHidden(hidden bool) Generator {
+	this.hidden = hidden
+	return this
+}
+
+func (this *generator) Generate(dir string) ([]byte, error) {
+	if !dirExist(dir) {
+		return nil, fmt.Errorf("指定目录'%s'不存在", dir)
+	}
+	if !isExportedName(this.typeName) {
+		return nil, fmt.Errorf("非法的结构体名'%s'", this.typeName)
+	}
+	buf := &strings.Builder{}
+	fmt.Fprintf(buf, "package %s\n\n", this.pkg)
+	fmt.Fprintf(buf, "// %s 由pdgen根据目录'%s'生成\n", this.typeName, filepath.ToSlash(dir))
+	fmt.Fprintf(buf, "type %s ", this.typeName)
+	if err := this.writeDir(buf, dir, make(map[string]bool)); err != nil {
+		return nil, err
+	}
+	buf.WriteString("\n")
+	src, err := format.Source([]byte(buf.String()))
+	if err != nil {
+		return nil, fmt.Errorf("格式化生成的代码失败：%s", err.Error())
+	}
+	return src, nil
+}
+
+// 将目录dir写成一个匿名结构体，ancestors为上级目录解析符号链接后的路径
+func (this *generator) writeDir(buf *strings.Builder, dir string, ancestors map[string]bool) error {
+	real, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return err
+	}
+	if ancestors[real] {
+		// 符号链接指向上级目录（如`a/up -> ..`），继续展开会无限循环
+		fmt.Fprintf(buf, "struct {\n// 指向上级目录'%s'的符号链接，不再展开\nPath string\n}", filepath.ToSlash(real))
+		return nil
+	}
+	ancestors[real] = true
+	defer delete(ancestors, real)
+
+	fis, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	sort.Slice(fis, func(i, j int) bool { return fis[i].Name() < fis[j].Name() })
+
+	buf.WriteString("struct {\n")
+	buf.WriteString("Path string\n")
+	// Path已被当前目录占用
+	used := map[string]bool{"Path": true}
+	for _, fi := range fis {
+		name := fi.Name()
+		if !this.hidden && strings.HasPrefix(name, ".") {
+			continue
+		}
+		isDir := fi.IsDir()
+		if fi.Mode()&os.ModeSymlink != 0 {
+			// 与探测逻辑一致，按链接目标判断
+			isDir = dirExist(filepath.Join(dir, name))
+		}
+		if strings.Contains(name, "`") {
+			// 无法写入struct tag的名字
+			fmt.Fprintf(buf, "// 跳过无法表示的名称：%q\n", name)
+			continue
+		}
+		fieldName, tag := this.inferField(name, isDir, used)
+		used[fieldName] = true
+		buf.WriteString(fieldName)
+		buf.WriteString(" ")
+		if isDir {
+			if err := this.writeDir(buf, filepath.Join(dir, name), ancestors); err != nil {
+				return err
+			}
+		} else {
+			buf.WriteString("string")
+		}
+		if tag != "" {
+			fmt.Fprintf(buf, " `pd:%s`", strconv.Quote(tag))
+		}
+		buf.WriteString("\n")
+	}
+	buf.WriteString("}")
+	return nil
+}
+
+// 反推字段名及最少的tag，使得按当前规则推断的名称与name一致
+func (this *generator) inferField(name string, isDir bool, used map[string]bool) (string, string) {
+	// 推断出的名称也会展开变量，含有`$`、`{`或者以`~`开头的名称只能用Name指定
+	if escapeVars(name) == name {
+		for _, cand := range this.candidates(name, isDir) {
+			if used[cand.fieldName] {
+				continue
+			}
+			if this.inferName(cand.fieldName, cand.tag, isDir) == name {
+				return cand.fieldName, cand.tag.String()
+			}
+		}
+	}
+
+	// 推断不出来，只能用Name强制指定
+	fieldName := toFieldName(splitAlnum(name))
+	if fieldName == "" {
+		if isDir {
+			fieldName = "Dir"
+		} else {
+			fieldName = "File"
+		}
+	}
+	for i, base := 2, fieldName; used[fieldName]; i++ {
+		fieldName = fmt.Sprintf("%s%d", base, i)
+	}
+	return fieldName, envTag{Name: name}.String()
+}
+
+func (this *generator) inferName(fieldName string, tag envTag, isDir bool) string {
+	if isDir {
+		return inferDirName(fieldName, tag, this.dirSplit, this.directoryNameParseType)
+	}
+	return inferFileName(fieldName, tag, this.fileSplit, this.fileNameParseType)
+}
+
+type fieldCandidate struct {
+	fieldName string
+	tag       envTag
+}
+
+// 按tag由少到多列出可能的字段名及tag组合
+func (this *generator) candidates(name string, isDir bool) []fieldCandidate {
+	defSplit := this.fileSplit
+	if isDir {
+		defSplit = this.dirSplit
+	}
+
+	bases := []struct{ base, ext string }{{name, ""}}
+	if idx := strings.LastIndex(name, "."); idx > 0 && idx < len(name)-1 {
+		bases = append(bases, struct{ base, ext string }{name[:idx], name[idx+1:]})
+	}
+
+	res := make([]fieldCandidate, 0, 8)
+	for _, b := range bases {
+		// 默认分隔符
+		if fn := toFieldName(splitBy(b.base, defSplit)); fn != "" {
+			res = append(res, fieldCandidate{fn, envTag{Ext: b.ext}})
+		}
+		// 目录名中出现的其他分隔符
+		for _, sep := range separators(b.base) {
+			if sep == defSplit {
+				continue
+			}
+			if fn := toFieldName(splitBy(b.base, sep)); fn != "" {
+				res = append(res, fieldCandidate{fn, envTag{Ext: b.ext, Split: sep}})
+			}
+		}
+	}
+	sort.SliceStable(res, func(i, j int) bool {
+		return res[i].tag.count() < res[j].tag.count()
+	})
+	return res
+}
+
+func (this envTag) count() int {
+	n := 0
+	for _, s := range []string{this.Name, this.Split, this.Ext} {
+		if s != "" {
+			n++
+		}
+	}
+	return n
+}
+
+// 仅输出生成器会用到的tag
+func (this envTag) String() string {
+	s := ""
+	if this.Name != "" {
+		s += "Name(" + quoteTagValue(escapeVars(this.Name)) + ");"
+	}
+	if this.Ext != "" {
+		s += "Ext(" + quoteTagValue(this.Ext) + ");"
+	}
+	if this.Split != "" {
+		s += "Split(" + quoteTagValue(this.Split) + ");"
+	}
+	return s
+}
+
+// 名称中出现的非字母数字的字符，按出现顺序去重
+func separators(s string) []string {
+	res := make([]string, 0, 2)
+	seen := map[rune]bool{}
+	for _, r := range s {
+		if isAlnum(r) || seen[r] {
+			continue
+		}
+		seen[r] = true
+		res = append(res, string(r))
+	}
+	return res
+}
+
+func splitBy(s, sep string) []string {
+	if sep == "" {
+		return []string{s}
+	}
+	return strings.Split(s, sep)
+}
+
+func splitAlnum(s string) []string {
+	return strings.FieldsFunc(s, func(r rune) bool { return !isAlnum(r) })
+}
+
+// 把各段首字母大写后拼成字段名，无法拼出合法字段名时返回空
+func toFieldName(parts []string) string {
+	res := ""
+	for _, p := range parts {
+		if p == "" {
+			return ""
+		}
+		for _, r := range p {
+			if !isAlnum(r) {
+				return ""
+			}
+		}
+		rs := []rune(p)
+		rs[0] = unicode.ToUpper(rs[0])
+		res += string(rs)
+	}
+	if !isExportedName(res) {
+		return ""
+	}
+	return res
+}
+
+func isAlnum(r rune) bool {
+	return r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r))
+}
+
+func isExportedName(s string) bool {
+	return s != "" && isUpper([]rune(s)[0])
+}
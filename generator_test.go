@@ -0,0 +1,124 @@
+package detector
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestGeneratorInferField(t *testing.T) {
+	g := NewGenerator().(*generator)
+	cases := []struct {
+		name      string
+		isDir     bool
+		fieldName string
+		tag       string
+	}{
+		{"db.yaml", false, "DbYaml", ""},
+		{"dit-file.txt", false, "DitFile", "Ext(txt);Split(-);"},
+		{"db_config.json", false, "DbConfig", "Ext(json);Split(_);"},
+		{"runtimes", true, "Runtimes", ""},
+		{"priority_test", true, "PriorityTest", "Split(_);"},
+		{"DB.Config", false, "DBConfig", "Name(DB.Config);"},
+		{"9.txt", false, "File", "Name(9.txt);"},
+	}
+	for _, c := range cases {
+		fieldName, tag := g.inferField(c.name, c.isDir, map[string]bool{"Path": true})
+		if fieldName != c.fieldName || tag != c.tag {
+			t.Errorf(`%s: Exp(%s,"%s")==Act(%s,"%s")`, c.name, c.fieldName, c.tag, fieldName, tag)
+		}
+	}
+}
+
+func TestGeneratorGenerate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pdgen")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	os.MkdirAll(filepath.Join(dir, "conf"), 0755)
+	ioutil.WriteFile(filepath.Join(dir, "conf", "path"), nil, 0644)
+	ioutil.WriteFile(filepath.Join(dir, "conf", ".gitkeep"), nil, 0644)
+
+	src, err := NewGenerator().WithTypeName("Work").Generate(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := string(src)
+	if !strings.Contains(s, "type Work struct") ||
+		!strings.Contains(s, "Path2 string `pd:\"Name(path);\"`") ||
+		strings.Contains(s, "gitkeep") {
+		t.Error("预料之外的结果：", s)
+	}
+}
+
+func TestGeneratorSymlinkCycle(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pdgen")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	os.MkdirAll(filepath.Join(dir, "a"), 0755)
+	os.MkdirAll(filepath.Join(dir, "conf"), 0755)
+	if err := os.Symlink("..", filepath.Join(dir, "a", "up")); err != nil {
+		t.Skip("无法创建符号链接：", err)
+	}
+	// 指向同级目录的符号链接不是循环，仍然展开
+	os.Symlink("../conf", filepath.Join(dir, "a", "conf_link"))
+	ioutil.WriteFile(filepath.Join(dir, "conf", "db.yaml"), nil, 0644)
+
+	code, err := NewGenerator().Generate(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(code), "不再展开") || strings.Count(string(code), "DbYaml") != 2 {
+		t.Error("指向上级目录的符号链接不应该展开：\n", string(code))
+	}
+}
+
+func TestGeneratorRoundTrip(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pdgen")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	// 名称中含有会被展开的字符
+	names := []string{"price$x.txt", "{app}.txt", "~", "db.yaml"}
+	for _, name := range names {
+		ioutil.WriteFile(filepath.Join(dir, name), nil, 0644)
+	}
+	src, err := NewGenerator().WithPackage("layout").Generate(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 按生成的结构体探测，应该找到所有的文件
+	file, err := parser.ParseFile(token.NewFileSet(), "layout.go", src, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	typeSpec := file.Decls[0].(*ast.GenDecl).Specs[0].(*ast.TypeSpec)
+	g := &codeGenerator{types: map[string]ast.Expr{typeSpec.Name.Name: typeSpec.Type}}
+	spec, err := g.newSpec(typeSpec.Type, "", "", typeSpec.Name.Name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	paths := make([]string, len(spec.Children))
+	targets := make([]interface{}, len(spec.Children))
+	for i := range paths {
+		targets[i] = &paths[i]
+	}
+	if err := NewDetector().WithDir(dir).DetectSpec(spec, targets); err != nil {
+		t.Fatal(err, "\n", string(src))
+	}
+	for _, name := range names {
+		if !hasString(paths, filepath.Join(dir, name)) {
+			t.Errorf("没有找到%s：%v\n%s", name, paths, src)
+		}
+	}
+}
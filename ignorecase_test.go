@@ -0,0 +1,77 @@
+package detector
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestIgnoreCase(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	os.MkdirAll(filepath.Join(dir, "Conf"), 0755)
+	ioutil.WriteFile(filepath.Join(dir, "Conf", "DB.Config"), nil, 0644)
+	ioutil.WriteFile(filepath.Join(dir, "Dit-File.TXT"), nil, 0644)
+
+	type layout struct {
+		Conf struct {
+			Path     string
+			DBConfig string
+		}
+		DitFile string `pd:"Ext(txt);Split(-)"`
+	}
+	if err := NewDetector().WithDir(dir).Detect(&layout{}); err == nil {
+		t.Fatal("默认应该区分大小写")
+	}
+	var v layout
+	if err := NewDetector().WithDir(dir).WithCaseInsensitive().Detect(&v); err != nil {
+		t.Fatal(err)
+	}
+	if v.Conf.Path != filepath.Join(dir, "Conf") || v.Conf.DBConfig != filepath.Join(dir, "Conf", "DB.Config") || v.DitFile != filepath.Join(dir, "Dit-File.TXT") {
+		t.Error("应该使用实际的名称：", v)
+	}
+
+	var v2 struct {
+		DitFile string `pd:"Ext(txt);Split(-);IgnoreCase"`
+	}
+	if err := NewDetector().WithDir(dir).Detect(&v2); err != nil || v2.DitFile != filepath.Join(dir, "Dit-File.TXT") {
+		t.Error("IgnoreCase应该只对该成员生效：", v2.DitFile, err)
+	}
+
+	// 只有大小写不同的名称无法确定
+	ioutil.WriteFile(filepath.Join(dir, "dit-file.txt"), nil, 0644)
+	if _, err := os.Stat(filepath.Join(dir, "DIT-FILE.txt")); err == nil {
+		t.Skip("文件系统不区分大小写")
+	}
+	if err := NewDetector().WithDir(dir).Detect(&v2); err == nil || !strings.Contains(err.Error(), "'Dit-File.TXT'、'dit-file.txt'") {
+		t.Error("有多个匹配的名称时应该报错：", err)
+	}
+}
+
+func TestNameNormalizer(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	// NFD形式的"é"，tag中为NFC形式
+	ioutil.WriteFile(filepath.Join(dir, "cafe\u0301.yaml"), nil, 0644)
+	// 简化的NFC转换，实际使用时可以传入norm.NFC.String
+	nfc := func(s string) string {
+		return strings.Replace(s, "e\u0301", "\u00e9", -1)
+	}
+	var v struct {
+		Cafe string `pd:"Name(café.yaml)"`
+	}
+	if err := NewDetector().WithDir(dir).Detect(&v); err == nil {
+		t.Error("没有正规化时应该找不到")
+	}
+	if err := NewDetector().WithDir(dir).WithNameNormalizer(nfc).Detect(&v); err != nil || v.Cafe != filepath.Join(dir, "cafe\u0301.yaml") {
+		t.Error("正规化后应该匹配，并使用实际的名称：", v.Cafe, err)
+	}
+}
@@ -2,18 +2,16 @@ package detector
 
 import (
 	"io"
+	"io/ioutil"
 	logpkg "log"
 )
 
-var log *logpkg.Logger = logpkg.New(new(nullLogger), "", 0)
+// 新建的Detector默认使用的logger，每个Detector持有自己的logger，探测过程中不会修改
+var defaultLogger = logpkg.New(ioutil.Discard, "", 0)
 
+// 设置之后新建的Detector默认使用的logger，已经创建的Detector不受影响。
+//
+// Deprecated: 使用Detector.WithLogger
 func SetLogger(out io.Writer, prefix string, flag int) {
-	log = logpkg.New(out, prefix, flag)
-}
-
-type nullLogger struct {
-}
-
-func (l *nullLogger) Write([]byte) (int, error) {
-	return 0, nil
+	defaultLogger = logpkg.New(out, prefix, flag)
 }
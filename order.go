@@ -0,0 +1,389 @@
+package detector
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// Schema中的一个目录或者文件，是探测时的一步
+type schemaStep struct {
+	// 目录或者文件，只有一个不为nil
+	dir  *dirSchema
+	file *fileSchema
+	// 所在目录的下标，根目录为-1
+	parent int
+	// Near(...)引用的成员的下标，-1表示没有
+	near int
+	// 必须在当前成员之前探测的成员的下标，包括所在目录
+	deps []int
+}
+
+func (this schemaStep) fieldPath() string {
+	if this.dir != nil {
+		return this.dir.fieldPath()
+	}
+	return joinFieldPath(this.file.ParentDir.fieldPath(), this.file.fieldName)
+}
+
+func (this schemaStep) priority() []string {
+	if this.dir != nil {
+		return this.dir.priority()
+	}
+	return this.file.priority()
+}
+
+// 对应的探测结果的下标，-1表示没有
+func (this schemaStep) targetIdx() int {
+	if this.dir != nil {
+		return this.dir.pathTargetIdx
+	}
+	return this.file.targetIdx
+}
+
+func (this schemaStep) tag() envTag {
+	if this.dir != nil {
+		return this.dir.fieldTag
+	}
+	return this.file.fieldTag
+}
+
+// 列出所有的目录和文件，并根据成员之间的引用计算探测顺序。
+// 没有引用时与定义顺序一致：先处理目录下的文件，再依次处理子目录。
+func (this *Schema) initOrder() error {
+	this.steps = make([]schemaStep, 0, this.numTargets+1)
+	this.refIndex = make(map[string]int)
+	var walk func(dir *dirSchema, parent int)
+	walk = func(dir *dirSchema, parent int) {
+		id := len(this.steps)
+		this.steps = append(this.steps, schemaStep{dir: dir, parent: parent, near: -1})
+		if parent >= 0 {
+			// 目录可以通过`${Conf}`或者`${Conf.Path}`引用
+			this.refIndex[dir.fieldPath()] = id
+			this.refIndex[joinFieldPath(dir.fieldPath(), dir.fieldTag.Path)] = id
+		}
+		for _, fileSch := range dir.ChildrenFile {
+			step := schemaStep{file: fileSch, parent: id, near: -1}
+			this.refIndex[step.fieldPath()] = len(this.steps)
+			this.steps = append(this.steps, step)
+		}
+		for _, dirSch := range dir.ChildrenDir {
+			walk(dirSch, id)
+		}
+	}
+	walk(this.root, -1)
+
+	// 收集依赖
+	for id := 1; id < len(this.steps); id++ {
+		step := &this.steps[id]
+		tag := step.tag()
+		step.deps = append(step.deps, step.parent)
+		refs := fieldRefs(tag.Name, this.refIndex)
+		for _, p := range step.priority() {
+			refs = append(refs, fieldRefs(p, this.refIndex)...)
+		}
+		if tag.Near != "" {
+			refs = append(refs, tag.Near)
+		}
+		for _, ref := range refs {
+			dep, ok := this.refIndex[ref]
+			if !ok {
+				return fmt.Errorf("成员%s引用了不存在的成员%s", step.fieldPath(), ref)
+			}
+			step.deps = append(step.deps, dep)
+			if ref == tag.Near {
+				step.near = dep
+			}
+		}
+	}
+
+	// 在满足依赖的前提下，尽量保持定义顺序
+	this.order = make([]int, 0, len(this.steps)-1)
+	done := make([]bool, len(this.steps))
+	done[0] = true
+	for len(this.order) < len(this.steps)-1 {
+		next := -1
+		for id := 1; id < len(this.steps) && next < 0; id++ {
+			if !done[id] && this.isReady(id, done) {
+				next = id
+			}
+		}
+		if next < 0 {
+			return this.cycleError(done)
+		}
+		done[next] = true
+		this.order = append(this.order, next)
+	}
+	return nil
+}
+
+func (this *Schema) isReady(id int, done []bool) bool {
+	for _, dep := range this.steps[id].deps {
+		if !done[dep] {
+			return false
+		}
+	}
+	return true
+}
+
+// 剩下的成员都至少有一个未探测的依赖，沿着依赖一定能找到环
+func (this *Schema) cycleError(done []bool) error {
+	cur := 0
+	for id := 1; id < len(this.steps); id++ {
+		if !done[id] {
+			cur = id
+			break
+		}
+	}
+	seen := make(map[int]int)
+	path := make([]int, 0)
+	for {
+		if start, ok := seen[cur]; ok {
+			path = append(path[start:], cur)
+			break
+		}
+		seen[cur] = len(path)
+		path = append(path, cur)
+		for _, dep := range this.steps[cur].deps {
+			if !done[dep] {
+				cur = dep
+				break
+			}
+		}
+	}
+	// 按`A -> B -> A`的顺序输出，表示A依赖B，B又依赖A
+	fields := make([]string, 0, len(path))
+	for _, id := range path {
+		fields = append(fields, this.steps[id].fieldPath())
+	}
+	return fmt.Errorf("成员之间存在循环引用：%s", strings.Join(fields, " -> "))
+}
+
+// 在工作目录baseDir下按顺序探测所有的目录和文件
+func (this *Schema) detect(state *detectState, baseDir string) error {
+	state.sch = this
+	state.paths = make([]string, len(this.steps))
+	state.paths[0] = baseDir
+	state.set(this.root.pathTargetIdx, baseDir)
+
+	run := newDetectRun(this, state)
+	if n := state._detector.concurrency; n > 1 {
+		return this.detectConcurrent(run, n)
+	}
+	for _, id := range this.order {
+		// 在每个成员之间检查是否已经取消
+		if err := state.call.ctx.Err(); err != nil {
+			return run.canceled(err)
+		}
+		if !run.need(id) {
+			continue
+		}
+		if err := run.commit(id, this.runStep(state, id)); err != nil {
+			return err
+		}
+	}
+	return run.result()
+}
+
+// 一个目录或者文件的探测结果
+type stepResult struct {
+	// 探测到的路径，第一个为当前成员的路径
+	paths []string
+	err   error
+	// 是否等待过，见Wait(...)、DetectWait
+	waited bool
+	// 探测时输出的信息
+	logs []string
+}
+
+// 使用state.paths中依赖的成员的探测结果，探测单个目录或者文件，不会修改state
+func (this *Schema) runStep(state *detectState, id int) stepResult {
+	step := this.steps[id]
+	s := state.fork(state.paths)
+	paths, err := this.detectStep(s, step)
+	deadline, wait := s.waitDeadline(step, this.optionalStep(id) < 0)
+	if wait && isMissing(err) && !s.call.noWait {
+		paths, err = this.waitStep(s, step, deadline, err)
+	}
+	return stepResult{paths: paths, err: err, waited: wait, logs: s.logs}
+}
+
+// 按探测顺序处理每个成员的探测结果，同时探测时也与按顺序探测的结果一致
+type detectRun struct {
+	sch   *Schema
+	state *detectState
+	// 出错的可选目录/文件，其下的成员不再探测
+	failed []bool
+	// 等待后仍然缺少的成员，其下及引用它的成员不再探测
+	blocked []bool
+	// 等待后仍然缺少的成员及其错误
+	missing     []int
+	missingErrs []error
+}
+
+func newDetectRun(sch *Schema, state *detectState) *detectRun {
+	return &detectRun{
+		sch:         sch,
+		state:       state,
+		failed:      make([]bool, len(sch.steps)),
+		blocked:     make([]bool, len(sch.steps)),
+		missing:     make([]int, 0),
+		missingErrs: make([]error, 0),
+	}
+}
+
+// 是否需要探测该成员，每个成员按探测顺序调用一次
+func (this *detectRun) need(id int) bool {
+	if this.sch.isSkipped(id, this.failed) {
+		return false
+	}
+	if this.sch.isBlocked(id, this.blocked) {
+		this.blocked[id] = true
+		return false
+	}
+	return true
+}
+
+// 写入成员的探测结果，出错且不能跳过时返回错误
+func (this *detectRun) commit(id int, res stepResult) error {
+	for _, line := range res.logs {
+		this.state._detector.logger.Println(line)
+	}
+	step := this.sch.steps[id]
+	if res.err == nil {
+		this.state.paths[id] = res.paths[0]
+		this.state.set(step.targetIdx(), res.paths...)
+		return nil
+	}
+	// 可选的目录/文件出错时直接跳过
+	if opt := this.sch.optionalStep(id); opt >= 0 {
+		this.failed[opt] = true
+		return nil
+	}
+	if res.waited && isMissing(res.err) {
+		// 继续探测其他成员，最后一起报错
+		this.blocked[id] = true
+		this.missing = append(this.missing, id)
+		this.missingErrs = append(this.missingErrs, res.err)
+		return nil
+	}
+	return this.sch.wrapError(id, res.err)
+}
+
+// 已经取消时，列出之前等待后仍然缺少的成员，否则返回ctx的错误
+func (this *detectRun) canceled(err error) error {
+	if len(this.missing) > 0 {
+		return this.result()
+	}
+	return err
+}
+
+func (this *detectRun) result() error {
+	if len(this.missing) > 0 {
+		return this.sch.waitError(this.missing, this.missingErrs)
+	}
+	return nil
+}
+
+func (this *Schema) detectStep(state *detectState, step schemaStep) ([]string, error) {
+	paths, err := this.detectPaths(state, step)
+	if err != nil {
+		return nil, err
+	}
+	for i, path := range paths {
+		if paths[i], err = state.applySymlinkPolicy(path, step.tag()); err != nil {
+			return nil, err
+		}
+		if state.contained(step.tag()) {
+			if err := state.checkContained(step.fieldPath(), paths[i], state.paths[step.parent]); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return paths, nil
+}
+
+func (this *Schema) detectPaths(state *detectState, step schemaStep) ([]string, error) {
+	// 重试时重新记录
+	state.danglings = nil
+	parentPath := state.paths[step.parent]
+	if step.near >= 0 {
+		// 与引用的成员在同一个目录下
+		nearPath := state.paths[step.near]
+		if nearPath == "" {
+			return nil, fmt.Errorf("Near(%s)没有探测结果", step.tag().Near)
+		}
+		parentPath = filepath.Dir(nearPath)
+	}
+	if step.dir != nil {
+		path, err := step.dir.detector(state, parentPath)
+		if state._detector.isDebug {
+			state.logf("\n%s", step.dir.genDoc(state._detector.sourceOrder(step.dir.fieldTag), parentPath))
+		}
+		if err != nil {
+			return nil, err
+		}
+		return []string{path}, nil
+	}
+	paths, err := step.file.detector(state, parentPath)
+	if state._detector.isDebug {
+		state.logf("\n%s", step.file.genDoc(state._detector.sourceOrder(step.file.fieldTag), parentPath))
+	}
+	return paths, err
+}
+
+// 所在的目录中有出错的可选目录
+func (this *Schema) isSkipped(id int, failed []bool) bool {
+	for p := this.steps[id].parent; p > 0; p = this.steps[p].parent {
+		if failed[p] {
+			return true
+		}
+	}
+	return false
+}
+
+// 所在目录或者引用的成员在等待后仍然缺少
+func (this *Schema) isBlocked(id int, blocked []bool) bool {
+	for _, dep := range this.steps[id].deps {
+		if blocked[dep] {
+			return true
+		}
+	}
+	return false
+}
+
+// 出错时会被跳过的可选目录/文件，即自身或者最近的可选的上级目录，-1表示没有
+func (this *Schema) optionalStep(id int) int {
+	for ; id > 0; id = this.steps[id].parent {
+		if this.steps[id].tag().Opt {
+			return id
+		}
+	}
+	return -1
+}
+
+// 从出错的成员开始逐级说明出错的位置，直到根目录
+func (this *Schema) wrapError(id int, err error) error {
+	for ; id > 0; id = this.steps[id].parent {
+		step := this.steps[id]
+		parent := this.steps[step.parent].dir
+		if step.dir != nil {
+			err = fmt.Errorf("处理%s的子目录%s出错{%w}", parent.Name, step.dir.Name, err)
+		} else {
+			err = fmt.Errorf("处理%s下的文件%s出错{%w}", parent.Name, step.file.Name, err)
+		}
+	}
+	return err
+}
+
+// 引用其他成员的探测结果，只能引用已经探测过的成员
+func (this *detectState) ref(name string) (string, error) {
+	id, ok := this.sch.refIndex[name]
+	if !ok {
+		return "", fmt.Errorf("不存在的成员%s", name)
+	}
+	if this.paths[id] == "" {
+		return "", fmt.Errorf("成员%s没有探测结果", name)
+	}
+	return this.paths[id], nil
+}
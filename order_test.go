@@ -0,0 +1,111 @@
+package detector
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestFieldRefs(t *testing.T) {
+	refs := fieldRefs("${Runtimes.Path}/log|$HOME|${HOME}|$${Conf.Path}|${Conf.DBYaml}|${Conf}|${InferFile}", map[string]int{"Conf": 1, "InferFile": 2})
+	if !reflect.DeepEqual(refs, []string{"Runtimes.Path", "Conf.DBYaml", "Conf", "InferFile"}) {
+		t.Error(refs)
+	}
+}
+
+func TestCrossFieldRefs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for _, p := range []string{"deploy/conf", "deploy/secrets", "var/log"} {
+		os.MkdirAll(filepath.Join(dir, p), 0755)
+	}
+	ioutil.WriteFile(filepath.Join(dir, "deploy", "conf", "db.yaml"), nil, 0644)
+	ioutil.WriteFile(filepath.Join(dir, "var", "log", "app.log"), nil, 0644)
+	os.Setenv("PD_REF_RUNTIMES", filepath.Join(dir, "var"))
+	defer os.Unsetenv("PD_REF_RUNTIMES")
+
+	var v struct {
+		Conf struct {
+			DBYaml string
+			// 引用后定义的目录
+			AppLog string `pd:"Name(app.log);Priority(${Runtimes.Path}/log)"`
+		} `pd:"Priority(deploy/conf)"`
+		Secrets struct {
+			Path string
+		} `pd:"Near(Conf)"`
+		Runtimes struct {
+			Path string
+		} `pd:"Key(PD_REF_RUNTIMES)"`
+	}
+	if err := NewDetector().WithDir(dir).Detect(&v); err != nil {
+		t.Fatal(err)
+	}
+	if v.Conf.AppLog != filepath.Join(dir, "var", "log", "app.log") {
+		t.Error("应该使用引用的目录的探测结果：", v.Conf.AppLog)
+	}
+	if v.Secrets.Path != filepath.Join(dir, "deploy", "secrets") {
+		t.Error("Near(Conf)应该在Conf所在的目录下搜索：", v.Secrets.Path)
+	}
+
+	// 顶层目录、顶层文件可以不带`.`引用，优先于同名的环境变量
+	os.Setenv("Conf", filepath.Join(dir, "var"))
+	defer os.Unsetenv("Conf")
+	ioutil.WriteFile(filepath.Join(dir, "deploy", "version"), nil, 0644)
+	var v2 struct {
+		Conf struct {
+			DBYaml string
+		} `pd:"Priority(deploy/conf)"`
+		Version string `pd:"Name(version);Priority(deploy)"`
+		Secrets struct {
+			Path string
+		} `pd:"Priority(${Conf}/../secrets)"`
+		Log struct {
+			Path string
+		} `pd:"Priority(${Version}/../../var/log)"`
+	}
+	if err := NewDetector().WithDir(dir).Detect(&v2); err != nil {
+		t.Fatal(err)
+	}
+	if v2.Secrets.Path != filepath.Join(dir, "deploy", "secrets") {
+		t.Error("${Conf}应该引用顶层目录：", v2.Secrets.Path)
+	}
+	if v2.Log.Path != filepath.Join(dir, "var", "log") {
+		t.Error("${Version}应该引用顶层文件：", v2.Log.Path)
+	}
+}
+
+func TestRefErrors(t *testing.T) {
+	cases := []struct {
+		layout interface{}
+		reason string
+	}{
+		{&struct {
+			A struct {
+				Path string
+			} `pd:"Priority(${B.Path})"`
+			B struct {
+				Path string
+			} `pd:"Near(A)"`
+		}{}, "循环引用：A -> B -> A"},
+		{&struct {
+			A struct {
+				DBYaml string `pd:"Priority(${A.Path})"`
+			} `pd:"Near(A.DBYaml)"`
+		}{}, "循环引用：A -> A.DBYaml -> A"},
+		{&struct {
+			DBYaml string `pd:"Near(Conf)"`
+		}{}, "成员DBYaml引用了不存在的成员Conf"},
+	}
+	for _, c := range cases {
+		_, err := NewDetector().Compile(reflect.TypeOf(c.layout))
+		if err == nil || !strings.Contains(err.Error(), c.reason) {
+			t.Errorf("应该报错%s，实际为%v", c.reason, err)
+		}
+	}
+}
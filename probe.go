@@ -0,0 +1,118 @@
+package detector
+
+import (
+	"fmt"
+	"path/filepath"
+	"time"
+)
+
+// 每个Detector同时在等待的检查数量上限，挂起的文件系统上的检查可能永远不会返回，避免goroutine无限增长
+const maxPendingProbes = 64
+
+// 路径在超时内没有响应，如挂起的NFS、FUSE挂载，与路径不存在不同
+type unreachableError struct {
+	path    string
+	timeout time.Duration
+}
+
+func (this *unreachableError) Error() string {
+	return fmt.Sprintf("路径'%s'无法访问：%s内没有响应", this.path, this.timeout)
+}
+
+// 检查路径，check返回实际的路径，不存在时返回空。
+// 设置了WithProbeTimeout时在单独的goroutine中检查，超时返回unreachableError。
+func (this *detectCall) probe(path string, check func() (string, error)) (string, error) {
+	ctx := this.ctx
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	timeout := this.probeTimeout
+	if timeout <= 0 {
+		return check()
+	}
+
+	select {
+	case this.pendingProbes <- struct{}{}:
+	default:
+		// 之前的检查都还没有返回，文件系统很可能已经挂起
+		return "", &unreachableError{path: path, timeout: timeout}
+	}
+	type result struct {
+		path string
+		err  error
+	}
+	res := make(chan result, 1)
+	go func() {
+		defer func() { <-this.pendingProbes }()
+		path, err := check()
+		res <- result{path: path, err: err}
+	}()
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case r := <-res:
+		return r.path, r.err
+	case <-timer.C:
+		return "", &unreachableError{path: path, timeout: timeout}
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+}
+
+func (this *detectState) probe(path string, check func() (string, error)) (string, error) {
+	return this.call.probe(path, check)
+}
+
+// 检查工作目录是否存在
+func (this *detectCall) dirExist(path string) (bool, error) {
+	p, err := this.probe(path, func() (string, error) {
+		if this.cache.dirExist(path) {
+			return path, nil
+		}
+		return "", nil
+	})
+	return p != "", err
+}
+
+// 通过目录列表的缓存检查，见DirCache
+func (this *detectState) fileExist(path string) (bool, error) {
+	p, err := this.probe(path, func() (string, error) {
+		if this.call.cache.fileExist(path) {
+			return path, nil
+		}
+		return "", nil
+	})
+	return p != "", err
+}
+
+func (this *detectState) dirExist(path string) (bool, error) {
+	p, err := this.probe(path, func() (string, error) {
+		if this.call.cache.dirExist(path) {
+			return path, nil
+		}
+		return "", nil
+	})
+	return p != "", err
+}
+
+// 在目录dir下查找name，isDir为true时要求是目录，返回实际的路径，不存在时返回空。
+// 设置了IgnoreCase()、WithCaseInsensitive或者WithNameNormalizer时，按目录列表匹配名称，见DirCache.match。
+func (this *detectState) join(dir, name string, isDir bool, tag envTag) (string, error) {
+	fold := tag.IgnoreCase || this._detector.caseInsensitive
+	normalize := this._detector.nameNormalizer
+	if !fold && normalize == nil {
+		p := filepath.Join(dir, name)
+		if ok, err := this.exists(p, isDir, tag); !ok {
+			return "", err
+		}
+		return p, nil
+	}
+	p, err := this.probe(filepath.Join(dir, name), func() (string, error) {
+		return this.call.cache.match(dir, name, isDir, fold, normalize)
+	})
+	if p == "" && err == nil {
+		// 原样的名称可能是失效的符号链接
+		_, err = this.exists(filepath.Join(dir, name), isDir, tag)
+	}
+	return p, err
+}
@@ -0,0 +1,86 @@
+package detector
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestProbeTimeout(t *testing.T) {
+	det := NewDetector().WithProbeTimeout(50 * time.Millisecond).(*detector)
+	state := &detectState{_detector: det, call: det.newCall(context.Background())}
+	hang := make(chan struct{})
+	defer close(hang)
+	// 模拟挂起的挂载点
+	_, err := state.probe("/mnt/nfs/db.yaml", func() (string, error) {
+		<-hang
+		return "/mnt/nfs/db.yaml", nil
+	})
+	if _, ok := err.(*unreachableError); !ok {
+		t.Fatal("超时应该视为无法访问：", err)
+	}
+	if isMissing(err) || !strings.Contains(err.Error(), "无法访问") {
+		t.Error("无法访问应该与不存在区分：", err)
+	}
+
+	ok, err := state.dirExist("/")
+	if !ok || err != nil {
+		t.Error("正常的检查不受影响：", ok, err)
+	}
+}
+
+func TestPendingProbesPerDetector(t *testing.T) {
+	hung := NewDetector().WithProbeTimeout(50 * time.Millisecond).(*detector)
+	// 模拟挂起的文件系统上已经积累了大量没有返回的检查
+	for i := 0; i < maxPendingProbes; i++ {
+		hung.pendingProbes <- struct{}{}
+	}
+	defer func() {
+		for i := 0; i < maxPendingProbes; i++ {
+			<-hung.pendingProbes
+		}
+	}()
+	if ok, err := hung.newCall(context.Background()).dirExist("/"); ok {
+		t.Error("检查已经全部挂起时应该视为无法访问：", err)
+	}
+	var v struct {
+		Tmp string `pd:"Priority(/tmp)"`
+	}
+	err := hung.WithDir("/").Detect(&v)
+	if err == nil || !strings.Contains(err.Error(), "无法访问") {
+		t.Error("工作目录的检查也应该受到超时的限制：", err)
+	}
+
+	other := NewDetector().WithProbeTimeout(50 * time.Millisecond).(*detector)
+	if ok, err := other.newCall(context.Background()).dirExist("/"); !ok || err != nil {
+		t.Error("其他Detector的检查不应该受到影响：", ok, err)
+	}
+}
+
+func TestDetectContext(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	ioutil.WriteFile(filepath.Join(dir, "db.yaml"), nil, 0644)
+	var v struct {
+		DBYaml string
+	}
+	if err := NewDetector().WithDir(dir).DetectContext(context.Background(), &v); err != nil {
+		t.Fatal(err)
+	}
+	if v.DBYaml != filepath.Join(dir, "db.yaml") {
+		t.Error(v.DBYaml)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := NewDetector().WithDir(dir).DetectContext(ctx, &v); err != context.Canceled {
+		t.Error("取消后应该返回ctx.Err()：", err)
+	}
+}
@@ -0,0 +1,108 @@
+package detector
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+// 布局片段的注册表。
+// 多个包各自声明自己需要的目录、文件，在init()中注册，
+// 由main统一调用一次DetectAll，所有片段使用同一个工作目录进行探测。
+type Registry struct {
+	mu        sync.Mutex
+	fragments []fragment
+}
+
+type fragment struct {
+	name   string
+	layout interface{}
+}
+
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+// 默认的注册表
+var defaultRegistry = NewRegistry()
+
+// 注册到默认的注册表
+func Register(name string, layout interface{}) {
+	defaultRegistry.Register(name, layout)
+}
+
+// 探测默认的注册表中的所有片段
+func DetectAll(det Detector) error {
+	return defaultRegistry.DetectAll(det)
+}
+
+// 注册一个布局片段，layout必须是结构体的指针，探测结果会直接写入该结构体。
+// 与sql.Register一致，一般在init()中调用，name重复或者layout非法时会panic。
+func (this *Registry) Register(name string, layout interface{}) {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	if name == "" {
+		panic("detector: 片段名不能为空")
+	}
+	if t := reflect.TypeOf(layout); t == nil || t.Kind() != reflect.Ptr || reflect.ValueOf(layout).IsNil() {
+		panic(fmt.Sprintf("detector: 片段%s必须是非nil的Ptr，实际为%T", name, layout))
+	}
+	for _, f := range this.fragments {
+		if f.name == name {
+			panic("detector: 重复注册的片段" + name)
+		}
+	}
+	this.fragments = append(this.fragments, fragment{name: name, layout: layout})
+}
+
+// 获取注册的布局片段，DetectAll成功后其中的路径即为探测结果
+func (this *Registry) Lookup(name string) (interface{}, bool) {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	for _, f := range this.fragments {
+		if f.name == name {
+			return f.layout, true
+		}
+	}
+	return nil, false
+}
+
+// 使用同一个工作目录探测所有注册的片段，结果写入各自注册的结构体。
+// 片段之间使用了同一个环境变量名，或者不同片段的文件探测到了同一个路径时，返回*CollisionError，
+// 宽松模式（WithLenient）下则只输出警告。
+func (this *Registry) DetectAll(det Detector) error {
+	this.mu.Lock()
+	fragments := append([]fragment{}, this.fragments...)
+	this.mu.Unlock()
+
+	d, ok := det.(*detector)
+	if !ok {
+		return fmt.Errorf("不支持的Detector：%T", det)
+	}
+
+	bound := make([]boundSchema, 0, len(fragments))
+	nodes := make([]collisionNode, 0)
+	for _, f := range fragments {
+		sch, err := d.Compile(reflect.TypeOf(f.layout))
+		if err != nil {
+			return fmt.Errorf("编译片段%s出错{%s}", f.name, err.Error())
+		}
+		b := boundSchema{
+			name:    f.name,
+			sch:     sch,
+			targets: sch.bind(reflect.ValueOf(f.layout).Elem()),
+		}
+		bound = append(bound, b)
+		for _, n := range sch.nodes {
+			nodes = append(nodes, collisionNode{schemaNode: n, owner: f.name})
+		}
+	}
+
+	// 片段之间的环境变量名冲突在探测前就可以确定
+	if err := d.checkCollisions(envKeyCollisions(nodes)); err != nil {
+		return err
+	}
+	// 路径冲突在探测时检查
+	return d.detectSchemas(d.newCall(context.Background()), bound...)
+}
@@ -0,0 +1,67 @@
+package detector
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+type authLayout struct {
+	Secrets struct {
+		Path string
+		JWT  string `pd:"Ext(key)"`
+	}
+}
+
+type searchLayout struct {
+	Secrets struct {
+		Path string
+	}
+	Runtimes struct {
+		Search struct {
+			Path string
+		}
+	}
+}
+
+func TestRegistry(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	os.MkdirAll(filepath.Join(dir, "secrets"), 0755)
+	os.MkdirAll(filepath.Join(dir, "runtimes", "search"), 0755)
+	ioutil.WriteFile(filepath.Join(dir, "secrets", "jwt.key"), nil, 0644)
+
+	auth := &authLayout{}
+	search := &searchLayout{}
+	reg := NewRegistry()
+	reg.Register("auth", auth)
+	reg.Register("search", search)
+	if err = reg.DetectAll(NewDetector().WithDir(dir)); err != nil {
+		t.Fatal(err)
+	}
+	if auth.Secrets.JWT != filepath.Join(dir, "secrets", "jwt.key") ||
+		search.Runtimes.Search.Path != filepath.Join(dir, "runtimes", "search") ||
+		search.Secrets.Path != auth.Secrets.Path {
+		t.Errorf("预料之外的结果：%+v %+v", auth, search)
+	}
+
+	// 两个片段声明了同一个文件
+	reg.Register("auth2", &authLayout{})
+	err = reg.DetectAll(NewDetector().WithDir(dir))
+	cErr, ok := err.(*CollisionError)
+	if !ok || len(cErr.Collisions) != 1 || cErr.Collisions[0].Kind != CollisionKind.EnvKey ||
+		cErr.Collisions[0].Fields[0] != "auth2:Secrets.JWT" {
+		t.Error("应该报告环境变量名的冲突：", err)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("重复注册应该panic")
+		}
+	}()
+	reg.Register("auth", &authLayout{})
+}
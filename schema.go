@@ -0,0 +1,279 @@
+package detector
+
+import (
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"sync"
+)
+
+// 编译后的结构体布局。
+// 所有tag在编译时解析、校验，编译结果不可变，可以在多次、并发的探测间共享。
+type Schema struct {
+	root *dirSchema
+	// 探测结果（string成员）的数量
+	numTargets int
+	// 反射时每个探测结果对应的成员下标
+	targetIndex [][]int
+	// 除根目录以外的所有目录和文件
+	nodes []schemaNode
+	// 编译时发现的环境变量名冲突
+	envCollisions []Collision
+	// 所有的目录和文件，下标0为根目录
+	steps []schemaStep
+	// 探测顺序，不包括根目录
+	order []int
+	// 可以被引用的成员路径，如`Runtimes.Path`，对应steps中的下标
+	refIndex map[string]int
+}
+
+// 会影响Schema编译结果的配置，作为缓存key的一部分，必须是可比较的
+type schemaOptions struct {
+	envPrefix string
+
+	directoryNameParseType NameParseTypeID
+	dirSplit               string
+
+	fileNameParseType NameParseTypeID
+	fileSplit         string
+
+	// 忽略不支持的成员，而不是报错
+	ignoreUnsupported bool
+	// 环境变量名的生成规则
+	envKeyStyle *EnvKeyFunc
+	// 根目录的tag，只能使用会传递给子孙成员的tag
+	defaultTag string
+}
+
+type schemaKey struct {
+	// reflect.Type或者*Spec
+	src  interface{}
+	opts schemaOptions
+}
+
+var (
+	stringType         = reflect.TypeOf("")
+	stringPtrType      = reflect.TypeOf((*string)(nil))
+	stringSlicePtrType = reflect.TypeOf((*[]string)(nil))
+)
+
+// 全局的Schema缓存，key为schemaKey
+var schemaCache sync.Map
+
+func (this *detector) Compile(t reflect.Type) (*Schema, error) {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() == reflect.Ptr {
+		return nil, fmt.Errorf("为了防止意外的循环引用，请不要使用Ptr类型")
+	}
+	if t.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("%s不是Struct", t.String())
+	}
+
+	cache := this.compileCache()
+	key := schemaKey{src: t, opts: this.schemaOptions}
+	if sch, ok := cache.Load(key); ok {
+		return this.checkSchema(sch.(*Schema))
+	}
+	spec, err := newSpec(t, nil, "", this.ignoreUnsupported)
+	if err != nil {
+		return nil, err
+	}
+	sch, err := this.schemaOptions.compile(spec)
+	if err != nil {
+		return nil, err
+	}
+	sch.targetIndex = specTargetIndex(spec, nil, nil)
+	actual, _ := cache.LoadOrStore(key, sch)
+	return this.checkSchema(actual.(*Schema))
+}
+
+func (this *detector) compileSpec(spec *Spec) (*Schema, error) {
+	cache := this.compileCache()
+	key := schemaKey{src: spec, opts: this.schemaOptions}
+	if sch, ok := cache.Load(key); ok {
+		return this.checkSchema(sch.(*Schema))
+	}
+	if !spec.Dir {
+		return nil, fmt.Errorf("根Spec必须是目录")
+	}
+	sch, err := this.schemaOptions.compile(spec)
+	if err != nil {
+		return nil, err
+	}
+	actual, _ := cache.LoadOrStore(key, sch)
+	return this.checkSchema(actual.(*Schema))
+}
+
+// 使用自定义的EnvKeyStyle时，编译结果只缓存在Detector上，避免每次设置生成的新引用使全局缓存无限增长
+func (this *detector) compileCache() *sync.Map {
+	if isBuiltinEnvKeyStyle(this.envKeyStyle) {
+		return &schemaCache
+	}
+	return &this.schemas
+}
+
+// 根据当前的配置检查编译结果中的冲突，以及WithResolutionOrder设置的顺序
+func (this *detector) checkSchema(sch *Schema) (*Schema, error) {
+	if len(this.resolutionOrder) == 0 {
+		return nil, fmt.Errorf("WithResolutionOrder：探测顺序不能为空")
+	}
+	if err := validateOrder(this.resolutionOrder); err != "" {
+		return nil, fmt.Errorf("WithResolutionOrder：%s", err)
+	}
+	if err := this.checkCollisions(sch.envCollisions); err != nil {
+		return nil, err
+	}
+	return sch, nil
+}
+
+// 值接收者：Schema中保存的是编译时配置的副本，之后修改Detector的配置不会影响已经编译（及缓存）的Schema
+func (this schemaOptions) compile(spec *Spec) (*Schema, error) {
+	var err error
+	sch := &Schema{}
+	sch.root, err = this.newDirSchema(spec, nil, &sch.numTargets)
+	if err != nil {
+		return nil, err
+	}
+	if err = sch.initOrder(); err != nil {
+		return nil, err
+	}
+	sch.nodes = sch.walkNodes()
+	nodes := make([]collisionNode, 0, len(sch.nodes))
+	for _, n := range sch.nodes {
+		nodes = append(nodes, collisionNode{schemaNode: n})
+	}
+	sch.envCollisions = envKeyCollisions(nodes)
+	return sch, nil
+}
+
+// 按Spec的顺序计算所有string成员的下标
+func specTargetIndex(spec *Spec, prefix []int, res [][]int) [][]int {
+	for _, child := range spec.Children {
+		index := append(append(make([]int, 0, len(prefix)+len(child.index)), prefix...), child.index...)
+		if child.Dir {
+			res = specTargetIndex(child, index, res)
+		} else {
+			res = append(res, index)
+		}
+	}
+	return res
+}
+
+// 根据结构体的值绑定探测结果，每个结果为*string或者*[]string
+func (this *Schema) bind(v reflect.Value) []interface{} {
+	targets := make([]interface{}, len(this.targetIndex))
+	for i, index := range this.targetIndex {
+		field := v.FieldByIndex(index).Addr()
+		// 兼容以string、[]string为底层类型的自定义类型
+		if field.Type().Elem().Kind() == reflect.Slice {
+			targets[i] = field.Convert(stringSlicePtrType).Interface()
+		} else {
+			targets[i] = field.Convert(stringPtrType).Interface()
+		}
+	}
+	return targets
+}
+
+// 一次探测过程中的状态，Schema本身不会被修改
+type detectState struct {
+	_detector *detector
+	call      *detectCall
+	sch       *Schema
+	// 当前使用的工作目录
+	baseDir string
+	// 按Schema.steps的顺序存储已经探测到的路径，未探测或者出错时为空
+	paths []string
+	// 按Schema中的顺序存储探测结果的成员
+	targets []interface{}
+	// 探测当前成员时输出的信息，按探测顺序输出到logger，见detectRun.commit
+	logs []string
+	// 探测当前成员时遇到的失效的符号链接，用于说明找不到的原因
+	danglings []string
+}
+
+// 输出信息到logger，同时探测时也保持探测顺序
+func (this *detectState) logf(format string, args ...interface{}) {
+	this.logs = append(this.logs, fmt.Sprintf(format, args...))
+}
+
+// 探测单个成员时使用的状态，paths为依赖的成员的探测结果
+func (this *detectState) fork(paths []string) *detectState {
+	s := *this
+	s.paths = paths
+	s.logs = nil
+	s.danglings = nil
+	return &s
+}
+
+// 展开路径中的变量，见expandPath
+func (this *detectState) expand(s string) (string, error) {
+	return expandPath(s, expandVars{baseDir: this.baseDir, ref: this.ref, refs: this.sch.refIndex})
+}
+
+// 展开路径中的变量，相对路径以anchorDir为起点，返回清理后的路径
+func (this *detectState) resolve(s, anchorDir string) (string, error) {
+	path, err := this.expand(s)
+	if err != nil || path == "" {
+		return path, err
+	}
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(anchorDir, path)
+	}
+	return filepath.Clean(path), nil
+}
+
+// Priority中相对路径的起点
+func (this *detectState) priorityAnchor(tag envTag, parentPath string) string {
+	anchor := tag.Anchor
+	if anchor == 0 {
+		anchor = this._detector.priorityAnchor
+	}
+	if anchor == Anchor.ParentDir && parentPath != "" {
+		return parentPath
+	}
+	return this.baseDir
+}
+
+// 写入探测结果，string成员只使用第一个路径
+func (this *detectState) set(idx int, paths ...string) {
+	if idx < 0 {
+		return
+	}
+	switch target := this.targets[idx].(type) {
+	case *string:
+		if target == nil {
+			return
+		}
+		if len(paths) > 0 {
+			*target = paths[0]
+		} else {
+			*target = ""
+		}
+	case *[]string:
+		if target == nil {
+			return
+		}
+		if len(paths) == 1 && paths[0] == "" {
+			// 未探测到的目录
+			paths = nil
+		}
+		*target = paths
+	}
+}
+
+// 读取探测结果
+func targetPaths(target interface{}) []string {
+	switch target := target.(type) {
+	case *string:
+		if target != nil && *target != "" {
+			return []string{*target}
+		}
+	case *[]string:
+		if target != nil {
+			return *target
+		}
+	}
+	return nil
+}
@@ -0,0 +1,77 @@
+package detector
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+type schemaTestLayout struct {
+	Path string
+	Conf struct {
+		Path   string
+		DBYaml string
+	}
+}
+
+func TestCompileCache(t *testing.T) {
+	typ := reflect.TypeOf(schemaTestLayout{})
+	sch1, err := NewDetector().Compile(typ)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sch2, _ := NewDetector().Compile(reflect.PtrTo(typ))
+	if sch1 != sch2 {
+		t.Error("相同类型、相同配置应该共享编译结果")
+	}
+	sch3, _ := NewDetector().WithEnvPrefix("APP").Compile(typ)
+	if sch1 == sch3 {
+		t.Error("不同配置不应该共享编译结果")
+	}
+
+	// 缓存的编译结果不受之后修改配置的影响
+	det := NewDetector().WithEnvPrefix("PD_OPTS")
+	sch4, _ := det.Compile(typ)
+	det.WithEnvPrefix("OTHER").WithFileSplit("-")
+	if sch4.root.opts.envPrefix != "PD_OPTS" || sch4.root.opts.fileSplit != "." {
+		t.Error("编译结果应该保存配置的副本：", sch4.root.opts.envPrefix, sch4.root.opts.fileSplit)
+	}
+
+	_, err = NewDetector().Compile(reflect.TypeOf(struct {
+		File string `pd:"Unknown(x)"`
+	}{}))
+	if err == nil {
+		t.Error("非法的tag应该在编译时报错")
+	}
+}
+
+func TestDetectConcurrent(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	os.MkdirAll(filepath.Join(dir, "conf"), 0755)
+	ioutil.WriteFile(filepath.Join(dir, "conf", "db.yaml"), nil, 0644)
+
+	det := NewDetector().WithDir(dir)
+	wg := sync.WaitGroup{}
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var layout schemaTestLayout
+			if err := det.Detect(&layout); err != nil {
+				t.Error(err)
+				return
+			}
+			if layout.Conf.DBYaml != filepath.Join(dir, "conf", "db.yaml") {
+				t.Error("预料之外的结果：", layout.Conf.DBYaml)
+			}
+		}()
+	}
+	wg.Wait()
+}
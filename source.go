@@ -0,0 +1,74 @@
+package detector
+
+import (
+	"fmt"
+	"strings"
+)
+
+type SourceID = string
+
+// 探测目录/文件路径的来源
+var Source = struct {
+	// 环境变量
+	Env SourceID
+	// Priority(...)中的路径
+	Priority SourceID
+	// 父目录
+	Parent SourceID
+	// 根据父目录推断，不检查是否存在，只有设置了Infer()或者在Order(...)中明确列出时有效
+	Infer SourceID
+}{
+	Env:      "env",
+	Priority: "priority",
+	Parent:   "parent",
+	Infer:    "infer",
+}
+
+// 默认的探测顺序
+var defaultResolutionOrder = []SourceID{Source.Env, Source.Priority, Source.Parent, Source.Infer}
+
+// 检查探测顺序，每个来源最多出现一次，未列出的来源不会使用
+func validateOrder(order []SourceID) string {
+	seen := make(map[SourceID]bool, len(order))
+	for _, source := range order {
+		switch source {
+		case Source.Env, Source.Priority, Source.Parent, Source.Infer:
+		default:
+			return fmt.Sprintf("未知的来源'%s'，只能是%s", source, strings.Join(defaultResolutionOrder, "、"))
+		}
+		if seen[source] {
+			return fmt.Sprintf("重复的来源'%s'", source)
+		}
+		seen[source] = true
+	}
+	return ""
+}
+
+func containsSource(order []SourceID, source SourceID) bool {
+	for _, s := range order {
+		if s == source {
+			return true
+		}
+	}
+	return false
+}
+
+// 成员实际使用的探测顺序：tag中的Order(...)优先于WithResolutionOrder(...)。
+// 推断只有在设置了Infer()或者在Order(...)中明确列出时有效，设置了Infer()但顺序中没有推断时放在最后。
+func (this *detector) sourceOrder(tag envTag) []SourceID {
+	order := tag.Order
+	if len(order) == 0 {
+		order = this.resolutionOrder
+	}
+	inferable := tag.Infer || containsSource(tag.Order, Source.Infer)
+	res := make([]SourceID, 0, len(order)+1)
+	for _, source := range order {
+		if source != Source.Infer || inferable {
+			res = append(res, source)
+		}
+	}
+	if inferable && !containsSource(res, Source.Infer) {
+		res = append(res, Source.Infer)
+	}
+	return res
+}
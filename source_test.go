@@ -0,0 +1,81 @@
+package detector
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestResolutionOrder(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for _, p := range []string{"mnt", "stale", "conf"} {
+		os.MkdirAll(filepath.Join(dir, p), 0755)
+		ioutil.WriteFile(filepath.Join(dir, p, "secret.key"), nil, 0644)
+	}
+	os.Setenv("PD_ORDER_SECRET", filepath.Join(dir, "stale", "secret.key"))
+	defer os.Unsetenv("PD_ORDER_SECRET")
+
+	type layout struct {
+		Conf struct {
+			SecretKey string `pd:"Key(PD_ORDER_SECRET);Priority(mnt);Order(priority,env)"`
+			DevKey    string `pd:"Name(secret.key);Key(PD_ORDER_SECRET);Priority(mnt);Order(parent,env,priority)"`
+			EnvKey    string `pd:"Name(secret.key);Key(PD_ORDER_SECRET);Priority(mnt)"`
+		}
+	}
+	var v layout
+	if err := NewDetector().WithLenient().WithDir(dir).Detect(&v); err != nil {
+		t.Fatal(err)
+	}
+	if v.Conf.SecretKey != filepath.Join(dir, "mnt", "secret.key") {
+		t.Error("Order(priority,env)应该优先使用Priority：", v.Conf.SecretKey)
+	}
+	if v.Conf.DevKey != filepath.Join(dir, "conf", "secret.key") {
+		t.Error("Order(parent,...)应该优先使用父目录：", v.Conf.DevKey)
+	}
+	if v.Conf.EnvKey != filepath.Join(dir, "stale", "secret.key") {
+		t.Error("默认应该优先使用环境变量：", v.Conf.EnvKey)
+	}
+
+	v = layout{}
+	if err := NewDetector().WithLenient().WithResolutionOrder(Source.Parent).WithDir(dir).Detect(&v); err != nil {
+		t.Fatal(err)
+	}
+	if v.Conf.EnvKey != filepath.Join(dir, "conf", "secret.key") || v.Conf.SecretKey != filepath.Join(dir, "mnt", "secret.key") {
+		t.Error("WithResolutionOrder应该修改默认的顺序，且不覆盖tag：", v.Conf.EnvKey, v.Conf.SecretKey)
+	}
+
+	// 非法的顺序在编译时报错
+	for _, order := range [][]SourceID{{}, {Source.Env, Source.Env}} {
+		if err := NewDetector().WithResolutionOrder(order...).WithDir(dir).Detect(&v); err == nil || !strings.Contains(err.Error(), "WithResolutionOrder") {
+			t.Error("非法的顺序应该报错：", order, err)
+		}
+	}
+}
+
+func TestSourceOrderDoc(t *testing.T) {
+	et, err := parseTag("Priority(/mnt);Order(priority,parent,env);Infer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	det := NewDetector().(*detector)
+	order := det.sourceOrder(et)
+	if strings.Join(order, ",") != "priority,parent,env,infer" {
+		t.Error(order)
+	}
+	fs := &fileSchema{Name: "db.yaml", fieldTag: et, ParentDir: &dirSchema{}, envKeys: envKeys{keys: []string{"DB_YAML"}}}
+	doc := fs.genDoc(order, "/app")
+	if !(strings.Index(doc, "优先路径") < strings.Index(doc, "父目录") &&
+		strings.Index(doc, "父目录") < strings.Index(doc, "环境变量") &&
+		strings.Contains(doc, "\n4、") && strings.Contains(doc, "推断为'/app/db.yaml'")) {
+		t.Error("应该按实际的顺序输出：", doc)
+	}
+	if order := det.sourceOrder(envTag{}); strings.Join(order, ",") != "env,priority,parent" {
+		t.Error("未设置Infer()时不应该推断：", order)
+	}
+}
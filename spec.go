@@ -0,0 +1,173 @@
+package detector
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// 结构体布局的静态描述。
+// 反射时由结构体类型生成，代码生成时由go/ast生成，
+// 两者最终都交给同一套逻辑进行探测。
+type Spec struct {
+	// 字段名，根目录为空
+	Field string
+	// `pd`标签的内容
+	Tag string
+	// 是否是目录（struct），否则是string字段
+	Dir bool
+	// 是否是[]string字段，仅对文件有效，环境变量中所有存在的路径都会写入
+	List bool
+	// 目录下的成员，按字段定义的顺序
+	Children []*Spec
+
+	// 反射时相对于所在目录的结构体的成员下标，匿名成员展开后会有多级
+	index []int
+	// 展开时所在的匿名成员的深度
+	depth int
+	// 生成代码时相对于所在目录的结构体的选择器，如`Work.Path`
+	selector string
+	// 生成代码时成员是以string、[]string为底层类型的自定义类型
+	convert bool
+}
+
+// 根据结构体类型生成Spec。
+// 带有`pd:"-"`的成员会被忽略；不支持的成员（非string、[]string、struct类型或者未导出）默认报错，
+// 如果ignoreUnsupported则同样忽略，此时所有成员都被忽略的struct（如sync.Mutex）也会被忽略，返回nil。
+// 匿名的struct成员会被展开，其成员看做属于当前目录，除非设置了`Dir()`。
+func newSpec(t reflect.Type, f *reflect.StructField, fieldPath string, ignoreUnsupported bool) (*Spec, error) {
+	spec := &Spec{
+		Dir: true,
+	}
+	if f != nil {
+		spec.Field = f.Name
+		spec.Tag = f.Tag.Get("pd")
+	}
+	children, numFields, err := newChildSpecs(t, fieldPath, ignoreUnsupported, nil, 0)
+	if err != nil {
+		return nil, err
+	}
+	if spec.Children, err = flattenSpecs(children, fieldPath); err != nil {
+		return nil, err
+	}
+	if f != nil && ignoreUnsupported && len(spec.Children) == 0 && numFields > 0 {
+		// 没有任何可用成员，不看做目录
+		return nil, nil
+	}
+	return spec, nil
+}
+
+// 生成t的所有成员的Spec，匿名成员展开后的深度为depth+1
+func newChildSpecs(t reflect.Type, fieldPath string, ignoreUnsupported bool, prefix []int, depth int) ([]*Spec, int, error) {
+	children := make([]*Spec, 0, t.NumField())
+	numFields := 0
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		numFields++
+		index := append(append(make([]int, 0, len(prefix)+1), prefix...), i)
+		childPath := joinFieldPath(fieldPath, f.Name)
+		tag := f.Tag.Get("pd")
+		if tag == "-" {
+			continue
+		}
+		if f.Anonymous && f.Type.Kind() == reflect.Struct {
+			flatten, err := isFlattenTag(tag, childPath)
+			if err != nil {
+				return nil, 0, err
+			}
+			if flatten {
+				// 与encoding/json一致，即使匿名成员的类型未导出，其导出的成员仍然可用
+				embedded, n, err := newChildSpecs(f.Type, fieldPath, ignoreUnsupported, index, depth+1)
+				if err != nil {
+					return nil, 0, err
+				}
+				children = append(children, embedded...)
+				numFields += n
+				continue
+			}
+		}
+		if f.PkgPath != "" {
+			if ignoreUnsupported {
+				continue
+			}
+			return nil, 0, fmt.Errorf("成员%s未导出，无法写入路径，可以通过`pd:\"-\"`忽略", childPath)
+		}
+		switch f.Type.Kind() {
+		case reflect.Struct:
+			// 迭代
+			childSpec, err := newSpec(f.Type, &f, childPath, ignoreUnsupported)
+			if err != nil {
+				return nil, 0, err
+			}
+			if childSpec != nil {
+				childSpec.index, childSpec.depth = index, depth
+				children = append(children, childSpec)
+			}
+		case reflect.String:
+			children = append(children, &Spec{
+				Field: f.Name,
+				Tag:   tag,
+				index: index,
+				depth: depth,
+			})
+		case reflect.Slice:
+			if f.Type.Elem() != stringType {
+				if ignoreUnsupported {
+					continue
+				}
+				return nil, 0, fmt.Errorf("成员%s不支持的数据类型%s，可以通过`pd:\"-\"`忽略", childPath, f.Type.String())
+			}
+			children = append(children, &Spec{
+				Field: f.Name,
+				Tag:   tag,
+				List:  true,
+				index: index,
+				depth: depth,
+			})
+		default:
+			if ignoreUnsupported {
+				continue
+			}
+			return nil, 0, fmt.Errorf("成员%s不支持的数据类型%s，可以通过`pd:\"-\"`忽略", childPath, f.Type.String())
+		}
+	}
+	return children, numFields, nil
+}
+
+// 匿名成员是否需要展开，只有设置了`Dir()`时才看做子目录
+func isFlattenTag(tag, fieldPath string) (bool, error) {
+	et, err := parseTag(tag)
+	if err != nil {
+		err.(*TagError).Field = fieldPath
+		return false, err
+	}
+	if et.Dir {
+		return false, nil
+	}
+	if tag != "" {
+		return false, fmt.Errorf("匿名成员%s会被展开到当前目录，其tag`%s`无效，如需作为子目录请设置Dir()", fieldPath, tag)
+	}
+	return true, nil
+}
+
+// 处理展开后的同名成员：与Go的成员提升规则一致，浅的成员覆盖深的成员，同一深度的同名成员则报错
+func flattenSpecs(children []*Spec, fieldPath string) ([]*Spec, error) {
+	minDepth := make(map[string]int, len(children))
+	for _, child := range children {
+		if d, ok := minDepth[child.Field]; !ok || child.depth < d {
+			minDepth[child.Field] = child.depth
+		}
+	}
+	res := make([]*Spec, 0, len(children))
+	seen := make(map[string]bool, len(children))
+	for _, child := range children {
+		if child.depth != minDepth[child.Field] {
+			continue
+		}
+		if seen[child.Field] {
+			return nil, fmt.Errorf("成员%s在多个匿名成员中重复，无法确定使用哪一个", joinFieldPath(fieldPath, child.Field))
+		}
+		seen[child.Field] = true
+		res = append(res, child)
+	}
+	return res, nil
+}
@@ -0,0 +1,100 @@
+package detector
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+type ignoreTestLayout struct {
+	Path  string
+	Conf  struct{ Path string }
+	Skip  int `pd:"-"`
+	Mu    sync.Mutex
+	Count int
+	OnErr func(error)
+	cache string
+}
+
+func TestIgnoreUnsupported(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	os.MkdirAll(filepath.Join(dir, "conf"), 0755)
+
+	var layout ignoreTestLayout
+	err = NewDetector().WithDir(dir).Detect(&layout)
+	if err == nil || !strings.Contains(err.Error(), "Mu") {
+		t.Error("默认应该报告不支持的成员：", err)
+	}
+
+	err = NewDetector().WithDir(dir).WithIgnoreUnsupported().Detect(&layout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if layout.Conf.Path != filepath.Join(dir, "conf") {
+		t.Error("预料之外的结果：", layout.Conf.Path)
+	}
+
+	sch, _ := NewDetector().WithIgnoreUnsupported().Compile(reflect.TypeOf(&layout))
+	if sch.numTargets != 2 {
+		t.Error("Mu、cache等成员应该被忽略：", sch.numTargets)
+	}
+}
+
+type EmbeddedConf struct {
+	Path   string
+	DBYaml string
+}
+
+type embeddedLog struct {
+	DBYaml string
+}
+
+type embeddedTestLayout struct {
+	Path string
+	// 展开到根目录
+	EmbeddedConf
+	// 作为子目录
+	Conf struct {
+		EmbeddedConf `pd:"Dir()"`
+	}
+}
+
+func TestFlattenEmbedded(t *testing.T) {
+	sch, err := NewDetector().Compile(reflect.TypeOf(embeddedTestLayout{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	root := sch.root
+	if len(root.ChildrenFile) != 1 || root.ChildrenFile[0].Name != "db.yaml" || root.pathTargetIdx != 0 {
+		t.Error("匿名成员应该被展开到当前目录")
+	}
+	if len(root.ChildrenDir) != 1 || len(root.ChildrenDir[0].ChildrenDir) != 1 ||
+		root.ChildrenDir[0].ChildrenDir[0].Name != "embeddedconf" {
+		t.Error("设置了Dir()的匿名成员应该看做子目录")
+	}
+
+	// 外层的成员覆盖匿名成员中的同名成员
+	_, err = NewDetector().Compile(reflect.TypeOf(struct {
+		EmbeddedConf
+		DBYaml string
+	}{}))
+	if err != nil {
+		t.Error(err)
+	}
+	// 同一深度的同名成员无法确定
+	_, err = NewDetector().Compile(reflect.TypeOf(struct {
+		EmbeddedConf
+		embeddedLog
+	}{}))
+	if err == nil {
+		t.Error("同一深度的同名成员应该报错")
+	}
+}
@@ -0,0 +1,136 @@
+package detector
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// 最多给出的建议数量
+const maxSuggestions = 3
+
+// 常见的名称分隔符，用于尝试Split(...)
+var suggestSplits = []string{".", "_", "-"}
+
+// 找不到目录/文件时，可能是名称不一致
+type suggestion struct {
+	path string
+	// 使其匹配需要的tag
+	tag  string
+	dist int
+}
+
+// 在已经读取过的目录中查找与name相近的名称，返回形如`，是否是：'...'（Name(...)）`的说明，没有时返回空。
+// 只使用目录列表缓存中已有的目录，不会再访问文件系统。
+func (this *detectState) suggest(dirs []string, name string, variants map[string]string, isDir bool) string {
+	res := make([]suggestion, 0)
+	seen := make(map[string]bool)
+	for _, dir := range dirs {
+		if dir == "" {
+			continue
+		}
+		// Name中可能包含子目录
+		dir = filepath.Dir(filepath.Join(dir, name))
+		for _, candidate := range this.call.cache.cachedNames(dir, isDir) {
+			path := filepath.Join(dir, candidate)
+			if seen[path] {
+				continue
+			}
+			seen[path] = true
+			s := suggestion{path: path, tag: "Name(" + quoteTagValue(escapeVars(candidate)) + ")"}
+			if tag, ok := variants[candidate]; ok {
+				s.tag, s.dist = tag, 0
+			} else if strings.EqualFold(candidate, filepath.Base(name)) {
+				s.tag, s.dist = "IgnoreCase()", 0
+			} else if tag, ok := variants[strings.ToLower(candidate)]; ok {
+				s.tag, s.dist = tag+";IgnoreCase()", 0
+			} else {
+				s.dist = editDistance(strings.ToLower(candidate), strings.ToLower(filepath.Base(name)))
+				if s.dist > maxSuggestDistance(name) {
+					continue
+				}
+			}
+			res = append(res, s)
+		}
+	}
+	if len(res) == 0 {
+		return ""
+	}
+	sort.SliceStable(res, func(i, j int) bool {
+		if res[i].dist != res[j].dist {
+			return res[i].dist < res[j].dist
+		}
+		return res[i].path < res[j].path
+	})
+	if len(res) > maxSuggestions {
+		res = res[:maxSuggestions]
+	}
+	list := make([]string, 0, len(res))
+	for _, s := range res {
+		list = append(list, fmt.Sprintf("'%s'（%s）", s.path, s.tag))
+	}
+	return "，是否是：" + strings.Join(list, "、")
+}
+
+// 名称越长，允许的差异越多
+func maxSuggestDistance(name string) int {
+	if d := len(filepath.Base(name)) / 3; d > 2 {
+		return d
+	}
+	return 2
+}
+
+// 根据成员名及其他分隔符推断出的名称，以及使用该名称需要的tag
+func nameVariants(fieldName string, tag envTag, isDir bool, opts *schemaOptions) map[string]string {
+	res := make(map[string]string)
+	if tag.Name != "" {
+		return res
+	}
+	for _, split := range suggestSplits {
+		t := tag
+		t.Split = split
+		var name string
+		if isDir {
+			name = inferDirName(fieldName, t, opts.dirSplit, opts.directoryNameParseType)
+		} else {
+			name = inferFileName(fieldName, t, opts.fileSplit, opts.fileNameParseType)
+		}
+		if _, ok := res[name]; !ok {
+			res[name] = fmt.Sprintf("Split(%s)", split)
+		}
+	}
+	return res
+}
+
+// 两个字符串之间的编辑距离
+func editDistance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	cur := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		cur[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			cur[j] = min3(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(rb)]
+}
+
+func min3(a, b, c int) int {
+	if b < a {
+		a = b
+	}
+	if c < a {
+		a = c
+	}
+	return a
+}
@@ -0,0 +1,100 @@
+package detector
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSuggest(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	os.MkdirAll(filepath.Join(dir, "deploy"), 0755)
+	os.MkdirAll(filepath.Join(dir, "Runtime"), 0755)
+	ioutil.WriteFile(filepath.Join(dir, "dit-file.txt"), nil, 0644)
+	ioutil.WriteFile(filepath.Join(dir, "unrelated.json"), nil, 0644)
+	ioutil.WriteFile(filepath.Join(dir, "deploy", "DB.Config"), nil, 0644)
+	ioutil.WriteFile(filepath.Join(dir, "Log-File.TXT"), nil, 0644)
+
+	cases := []struct {
+		layout interface{}
+		expect []string
+	}{
+		{&struct {
+			DitFile string `pd:"Ext(txt)"`
+		}{}, []string{"'" + filepath.Join(dir, "dit-file.txt") + "'（Split(-)）"}},
+		{&struct {
+			DBConfig string `pd:"Priority(deploy)"`
+		}{}, []string{"'" + filepath.Join(dir, "deploy", "DB.Config") + "'（IgnoreCase()）"}},
+		{&struct {
+			LogFile string `pd:"Ext(txt)"`
+		}{}, []string{"'" + filepath.Join(dir, "Log-File.TXT") + "'（Split(-);IgnoreCase()）"}},
+		{&struct {
+			Runtimes struct {
+				Path string
+			}
+		}{}, []string{"'" + filepath.Join(dir, "Runtime") + "'（Name(Runtime)）"}},
+	}
+	for _, c := range cases {
+		err := NewDetector().WithDir(dir).Detect(c.layout)
+		if err == nil {
+			t.Fatal("应该报错")
+		}
+		for _, expect := range c.expect {
+			if !strings.Contains(err.Error(), "是否是："+expect) {
+				t.Error("应该给出建议：", expect, err)
+			}
+		}
+		if strings.Contains(err.Error(), "unrelated.json") {
+			t.Error("不应该建议差异太大的名称：", err)
+		}
+	}
+}
+
+// 建议的Name(...)需要转义，使其可以直接作为tag使用
+func TestSuggestEscapedName(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	const name = "{my}.db;$v2.yaml"
+	ioutil.WriteFile(filepath.Join(dir, name), nil, 0644)
+
+	err = NewDetector().WithDir(dir).Detect(&struct {
+		MyDBV2 string `pd:"Ext(yaml)"`
+	}{})
+	if err == nil {
+		t.Fatal("应该报错")
+	}
+	prefix := "是否是：'" + filepath.Join(dir, name) + "'（"
+	i := strings.Index(err.Error(), prefix)
+	if i < 0 {
+		t.Fatal("应该给出建议：", err)
+	}
+	tag := err.Error()[i+len(prefix):]
+	tag = tag[:strings.Index(tag, "）")]
+	if _, err := parseTag(tag); err != nil {
+		t.Fatal("建议的tag应该可以解析：", tag, err)
+	}
+
+	var res string
+	spec := &Spec{Dir: true, Children: []*Spec{{Field: "MyDBV2", Tag: tag}}}
+	if err := NewDetector().WithDir(dir).DetectSpec(spec, []interface{}{&res}); err != nil {
+		t.Fatal("使用建议的tag应该可以探测到：", tag, err)
+	}
+	if res != filepath.Join(dir, name) {
+		t.Error("使用建议的tag探测到的路径有误：", tag, res)
+	}
+}
+
+func TestEditDistance(t *testing.T) {
+	if editDistance("db.config", "db_config") != 1 || editDistance("", "abc") != 3 || editDistance("数据", "数据库") != 1 {
+		t.Error("编辑距离有误")
+	}
+}
@@ -0,0 +1,143 @@
+package detector
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+type SymlinkPolicyID = int8
+
+var SymlinkPolicy = struct {
+	// 按原样写入经过符号链接的路径
+	Follow SymlinkPolicyID
+	// 写入filepath.EvalSymlinks解析后的路径
+	Resolve SymlinkPolicyID
+	// 路径中的任意一级是符号链接时报错
+	Forbid SymlinkPolicyID
+	// 与Follow相同，但遇到失效的符号链接时报错，而不是继续查找
+	NoDangling SymlinkPolicyID
+}{
+	Follow:     1,
+	Resolve:    2,
+	Forbid:     3,
+	NoDangling: 4,
+}
+
+// tag`Symlink(...)`的参数
+var symlinkPolicyNames = map[string]SymlinkPolicyID{
+	"follow":     SymlinkPolicy.Follow,
+	"resolve":    SymlinkPolicy.Resolve,
+	"forbid":     SymlinkPolicy.Forbid,
+	"nodangling": SymlinkPolicy.NoDangling,
+}
+
+// 失效的符号链接，即指向的目标不存在
+type danglingError struct {
+	path, link string
+}
+
+func (this *danglingError) Error() string {
+	return fmt.Sprintf("'%s'是失效的符号链接，指向的'%s'不存在", this.path, this.link)
+}
+
+// 成员使用的符号链接策略
+func (this *detectState) symlinkPolicy(tag envTag) SymlinkPolicyID {
+	if tag.Symlink != 0 {
+		return tag.Symlink
+	}
+	if this._detector.symlinkPolicy != 0 {
+		return this._detector.symlinkPolicy
+	}
+	return SymlinkPolicy.Follow
+}
+
+// 检查路径是否存在，不存在且是失效的符号链接时，SymlinkPolicy.NoDangling下报错，否则记录下来用于说明找不到的原因
+func (this *detectState) exists(path string, isDir bool, tag envTag) (bool, error) {
+	var ok bool
+	var err error
+	if isDir {
+		ok, err = this.dirExist(path)
+	} else {
+		ok, err = this.fileExist(path)
+	}
+	if ok || err != nil {
+		return ok, err
+	}
+	var link string
+	dangling, err := this.probe(path, func() (string, error) {
+		l, ok := this.call.cache.danglingLink(path)
+		if !ok {
+			return "", nil
+		}
+		link = l
+		return path, nil
+	})
+	if err != nil {
+		return false, err
+	}
+	if dangling != "" {
+		err := &danglingError{path: path, link: link}
+		if this.symlinkPolicy(tag) == SymlinkPolicy.NoDangling {
+			return false, err
+		}
+		this.danglings = append(this.danglings, err.Error())
+	}
+	return false, nil
+}
+
+// 找不到时遇到的失效的符号链接，形如`（'...'是失效的符号链接，指向的'...'不存在）`
+func (this *detectState) danglingNote() string {
+	if len(this.danglings) == 0 {
+		return ""
+	}
+	return "（" + strings.Join(this.danglings, "；") + "）"
+}
+
+// 按符号链接策略处理探测到的路径
+func (this *detectState) applySymlinkPolicy(path string, tag envTag) (string, error) {
+	switch this.symlinkPolicy(tag) {
+	case SymlinkPolicy.Resolve:
+		return this.probe(path, func() (string, error) {
+			real, err := filepath.EvalSymlinks(path)
+			if err != nil {
+				if os.IsNotExist(err) {
+					// 推断的路径可能不存在
+					return path, nil
+				}
+				return "", err
+			}
+			return real, nil
+		})
+	case SymlinkPolicy.Forbid:
+		return this.probe(path, func() (string, error) {
+			if link := symlinkComponent(path); link != "" {
+				return "", fmt.Errorf("路径'%s'中的'%s'是符号链接，Symlink(forbid)不允许使用符号链接", path, link)
+			}
+			return path, nil
+		})
+	}
+	return path, nil
+}
+
+// 路径中第一个是符号链接的部分，没有时返回空，不存在的部分不再检查
+func symlinkComponent(path string) string {
+	path = filepath.Clean(path)
+	cur := filepath.VolumeName(path)
+	for _, part := range strings.Split(path[len(cur):], string(filepath.Separator)) {
+		if part == "" {
+			cur += string(filepath.Separator)
+			continue
+		}
+		cur = filepath.Join(cur, part)
+		fi, err := os.Lstat(cur)
+		if err != nil {
+			return ""
+		}
+		if fi.Mode()&os.ModeSymlink != 0 {
+			return cur
+		}
+	}
+	return ""
+}
@@ -0,0 +1,78 @@
+package detector
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSymlinkPolicy(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	// EvalSymlinks的结果需要与实际的临时目录比较
+	if dir, err = filepath.EvalSymlinks(dir); err != nil {
+		t.Fatal(err)
+	}
+	os.MkdirAll(filepath.Join(dir, "outside"), 0755)
+	os.MkdirAll(filepath.Join(dir, "secrets"), 0755)
+	ioutil.WriteFile(filepath.Join(dir, "outside", "tls.key"), nil, 0644)
+	os.Symlink(filepath.Join(dir, "outside", "tls.key"), filepath.Join(dir, "secrets", "tls.key"))
+	os.Symlink(filepath.Join(dir, "outside", "tls.crt"), filepath.Join(dir, "secrets", "tls.crt"))
+
+	type layout struct {
+		Secrets struct {
+			TLSKey string `pd:"Name(tls.key)"`
+		}
+	}
+	var v layout
+	if err := NewDetector().WithDir(dir).Detect(&v); err != nil || v.Secrets.TLSKey != filepath.Join(dir, "secrets", "tls.key") {
+		t.Error("默认应该按原样写入：", v.Secrets.TLSKey, err)
+	}
+	v = layout{}
+	if err := NewDetector().WithDir(dir).WithSymlinkPolicy(SymlinkPolicy.Resolve).Detect(&v); err != nil || v.Secrets.TLSKey != filepath.Join(dir, "outside", "tls.key") {
+		t.Error("Resolve应该写入解析后的路径：", v.Secrets.TLSKey, err)
+	}
+	err = NewDetector().WithDir(dir).WithSymlinkPolicy(SymlinkPolicy.Forbid).Detect(&layout{})
+	if err == nil || !strings.Contains(err.Error(), "'"+filepath.Join(dir, "secrets", "tls.key")+"'是符号链接") {
+		t.Error("Forbid应该拒绝符号链接：", err)
+	}
+
+	// tag优先于Detector的配置
+	var v2 struct {
+		Secrets struct {
+			TLSKey string `pd:"Name(tls.key);Symlink(follow)"`
+		}
+	}
+	if err := NewDetector().WithDir(dir).WithSymlinkPolicy(SymlinkPolicy.Forbid).Detect(&v2); err != nil {
+		t.Error("tag应该覆盖Detector的配置：", err)
+	}
+
+	// 失效的符号链接
+	type dangling struct {
+		Secrets struct {
+			TLSCrt string `pd:"Name(tls.crt)"`
+		}
+	}
+	expect := "'" + filepath.Join(dir, "secrets", "tls.crt") + "'是失效的符号链接，指向的'" + filepath.Join(dir, "outside", "tls.crt") + "'不存在"
+	err = NewDetector().WithDir(dir).Detect(&dangling{})
+	if err == nil || !strings.Contains(err.Error(), "找不到tls.crt的实际路径（"+expect) {
+		t.Error("找不到时应该说明失效的符号链接：", err)
+	}
+	var v3 struct {
+		TLSCrt string `pd:"Name(tls.crt);Priority(secrets);Symlink(nodangling)"`
+	}
+	// 父目录中存在，但优先级目录中的失效的符号链接先被检查到
+	ioutil.WriteFile(filepath.Join(dir, "tls.crt"), nil, 0644)
+	err = NewDetector().WithDir(dir).Detect(&v3)
+	if err == nil || !strings.Contains(err.Error(), expect) || strings.Contains(err.Error(), "找不到") {
+		t.Error("NoDangling遇到失效的符号链接时应该报错，不继续查找：", v3.TLSCrt, err)
+	}
+	if _, err := parseTag("Symlink(always)"); err == nil {
+		t.Error("应该拒绝未知的策略")
+	}
+}
@@ -2,14 +2,9 @@ package detector
 
 import (
 	"fmt"
-	"reflect"
-	"regexp"
 	"strings"
-)
-
-var (
-	// Priority(/run/configs)
-	tagReg = regexp.MustCompile(`^(\w+)\((\S*)\)$`)
+	"time"
+	"unicode"
 )
 
 type envTag struct {
@@ -21,6 +16,10 @@ type envTag struct {
 	// 则优先通过该变量尝试获取文件/目录名。
 	// 如果获取失败还是会进行推断。
 	Key string
+	// Key中的其他环境变量名，Key未设置时按顺序尝试，用于兼容改名前的环境变量
+	KeyAliases []string
+	// 已废弃的环境变量名，使用时会输出警告，不在Key中的会追加到最后尝试
+	Deprecated []string
 	// 生成蛇形名称时的分隔符，默认为"_"
 	Split string
 	// 后缀，如果设置了Ext，则自动拼接文件名时总是在后缀前使用"."作为拼接符，而不是FileSplit。
@@ -28,66 +27,361 @@ type envTag struct {
 	Ext string
 	// 如果设置了该项，则该文件/目录可以不存在
 	Opt bool
+	// 匹配名称时忽略大小写，结果使用实际的名称
+	IgnoreCase bool
+	// 符号链接策略，见SymlinkPolicy，未设置时使用Detector的配置
+	Symlink SymlinkPolicyID
+	// 要求路径解析符号链接后在工作目录、父目录或者WithAllowedRoots中的目录下
+	Contained bool
+	// 不存在时以递增的间隔重试，直到出现或者超过该时长（从探测开始计算）
+	Wait time.Duration
 	// 仅对struct有效，如果设置了该项。
 	// 则会把当前目录的路径写入该结构体的该名称的成员变量。
 	// 该成员必须是string类型
 	Path string
 	// 优先搜索目录
 	Priority []string
+	// 在该成员（形如`Conf`、`Runtimes.Log`）所在的目录下搜索，而不是父目录
+	Near string
+	// Priority中相对路径的起点，未设置时使用Detector的配置
+	Anchor AnchorID
+	// 探测顺序，见Source，未设置时使用Detector的配置
+	Order []SourceID
+	// 仅对目录有效，子孙文件默认的后缀，最近的上级目录的配置生效
+	FileExt string
+	// 仅对目录有效，子孙文件默认的分隔符，最近的上级目录的配置生效
+	FileSplit string
+	// 仅对目录有效，子成员的优先搜索目录，在子成员自身的Priority之前尝试
+	ChildPriority []string
 	// 如果设置了该项，则当探测失败时
 	// 基于其父目录和当前文件名，组合当前文件的路径并写入
 	Infer bool
+	// 仅对匿名的struct成员有效，如果设置了该项，
+	// 则该成员看做子目录，而不是展开到当前目录
+	Dir bool
 }
 
-func parseTag(tag reflect.StructTag) envTag {
-	s := tag.Get("pd")
-	if len(s) == 0 {
-		return envTag{
-			Path:     "Path",
-			Priority: []string{},
-		}
+// tag解析错误
+type TagError struct {
+	// 出错的成员，形如`Conf.DitFile`
+	Field string
+	// 完整的tag
+	Tag string
+	// 出错的片段
+	Fragment string
+	// 出错片段在tag中的字节偏移
+	Offset int
+	// 出错原因
+	Reason string
+}
+
+func (this *TagError) Error() string {
+	return fmt.Sprintf("成员%s的tag`%s`在第%d字节`%s`处有误：%s", this.Field, this.Tag, this.Offset, this.Fragment, this.Reason)
+}
+
+// 解析形如`Name(db.yaml);Priority(/run/conf|'/mnt/my conf');Opt`的tag。
+//
+// 每一项由tag名及可选的括号参数组成，项之间用`;`分隔，多个参数之间用`|`分隔。
+// 参数两端的空白会被忽略，可以用单引号或双引号包裹参数以保留空白及特殊字符，
+// 也可以用`\`转义`;`、`|`、`(`、`)`、引号、空白及`\`本身，`\`后是其他字符时按原样保留，如`C:\conf`。
+func parseTag(s string) (envTag, error) {
+	return parseTagOnly(s, nil)
+}
+
+// 与parseTag一致，allowed不为空时只能使用其中的tag
+func parseTagOnly(s string, allowed []string) (envTag, error) {
+	et := envTag{
+		Priority: []string{},
 	}
-	et := envTag{}
-	sl := strings.Split(s, ";")
-	for _, s := range sl {
-		if s == "" {
+	p := &tagParser{s: s}
+	seen := make(map[string]bool)
+	for {
+		p.skipSpace()
+		if p.eof() {
+			break
+		}
+		if p.peek() == ';' {
+			p.pos++
 			continue
 		}
-		match := tagReg.FindStringSubmatch(s)
-		switch match[1] {
-		case "Name":
-			et.Name = match[2]
-		case "Key":
-			et.Key = match[2]
-			switch true {
-			case et.Key == "-":
-				// 要求不使用环境变量
-			case et.Key != "":
-				if !isValidateEnvKey(et.Key) {
-					panic(fmt.Sprintf("非法的环境变量名'%s'，必须由字母、数字或下划线组成，且数字不是开头。", et.Key))
-				}
+
+		start := p.pos
+		name := p.ident()
+		if name == "" {
+			return et, p.errorf(start, p.pos+1, "需要tag名")
+		}
+		p.skipSpace()
+		var args []string
+		if !p.eof() && p.peek() == '(' {
+			var err error
+			if args, err = p.args(); err != nil {
+				return et, err
 			}
-		case "Split":
-			et.Split = match[2]
-		case "Ext":
-			et.Ext = match[2]
-		case "Opt":
-			et.Opt = true
-		case "Priority":
-			et.Priority = strings.Split(match[2], "|")
-		case "Path":
-			et.Path = match[2]
-		case "Infer":
-			et.Infer = true
-		default:
-			panic("未知的tag：" + match[1])
+			p.skipSpace()
+		}
+		if !p.eof() && p.peek() != ';' {
+			return et, p.errorf(start, p.pos+1, "需要`;`")
+		}
+		if seen[name] {
+			return et, p.errorf(start, p.pos, "重复的tag")
+		}
+		seen[name] = true
+		if len(allowed) > 0 && !hasString(allowed, name) {
+			return et, p.errorf(start, p.pos, fmt.Sprintf("只能使用%s，不能使用%s", strings.Join(allowed, "、"), name))
+		}
+		if err := et.apply(name, args); err != "" {
+			return et, p.errorf(start, p.pos, err)
 		}
 	}
 
+	if et.Key == "-" && len(et.Deprecated) > 0 {
+		return et, p.errorf(0, p.pos, "Key(-)不能与Deprecated同时使用")
+	}
 	if et.Path == "" {
 		et.Path = "Path"
 	}
-	return et
+	return et, nil
+}
+
+func validateEnvKeys(keys []string) string {
+	seen := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		if !isValidateEnvKey(key) {
+			return fmt.Sprintf("非法的环境变量名'%s'，必须由字母、数字或下划线组成，且数字不是开头。", key)
+		}
+		if seen[key] {
+			return fmt.Sprintf("重复的环境变量名'%s'", key)
+		}
+		seen[key] = true
+	}
+	return ""
+}
+
+// 根据tag名及参数设置envTag，出错时返回原因
+func (this *envTag) apply(name string, args []string) string {
+	switch name {
+	case "Name", "Split", "Ext", "Path", "Anchor", "Near", "FileExt", "FileSplit", "Wait", "Symlink":
+		if len(args) != 1 {
+			return fmt.Sprintf("%s需要且只能有1个参数", name)
+		}
+	case "Priority", "Key", "Deprecated", "Order", "ChildPriority":
+		if len(args) == 0 {
+			return name + "至少需要1个参数"
+		}
+		for _, arg := range args {
+			if arg == "" {
+				return name + "的参数不能为空"
+			}
+		}
+	case "Opt", "Infer", "Dir", "IgnoreCase", "Contained":
+		if len(args) > 1 || (len(args) == 1 && args[0] != "") {
+			return fmt.Sprintf("%s不需要参数", name)
+		}
+	default:
+		return "未知的tag：" + name
+	}
+
+	switch name {
+	case "Name":
+		this.Name = args[0]
+	case "Key":
+		if args[0] == "-" && len(args) == 1 {
+			// 要求不使用环境变量
+			this.Key = "-"
+			break
+		}
+		if err := validateEnvKeys(args); err != "" {
+			return err
+		}
+		this.Key = args[0]
+		if len(args) > 1 {
+			this.KeyAliases = args[1:]
+		}
+	case "FileExt":
+		this.FileExt = args[0]
+	case "FileSplit":
+		this.FileSplit = args[0]
+	case "ChildPriority":
+		this.ChildPriority = args
+	case "Order":
+		// 除了`|`，也可以使用`,`分隔
+		order := make([]SourceID, 0, len(args))
+		for _, arg := range args {
+			for _, source := range strings.Split(arg, ",") {
+				order = append(order, strings.TrimSpace(source))
+			}
+		}
+		if err := validateOrder(order); err != "" {
+			return err
+		}
+		this.Order = order
+	case "Near":
+		if args[0] == "" {
+			return "Near的参数不能为空"
+		}
+		this.Near = args[0]
+	case "Anchor":
+		switch args[0] {
+		case "base":
+			this.Anchor = Anchor.BaseDir
+		case "parent":
+			this.Anchor = Anchor.ParentDir
+		default:
+			return fmt.Sprintf("Anchor的参数只能是base或者parent，实际为'%s'", args[0])
+		}
+	case "Symlink":
+		policy, ok := symlinkPolicyNames[args[0]]
+		if !ok {
+			return fmt.Sprintf("Symlink的参数只能是follow、resolve、forbid或者nodangling，实际为'%s'", args[0])
+		}
+		this.Symlink = policy
+	case "Deprecated":
+		if err := validateEnvKeys(args); err != "" {
+			return err
+		}
+		this.Deprecated = args
+	case "Split":
+		this.Split = args[0]
+	case "Ext":
+		this.Ext = args[0]
+	case "Opt":
+		this.Opt = true
+	case "IgnoreCase":
+		this.IgnoreCase = true
+	case "Contained":
+		this.Contained = true
+	case "Wait":
+		wait, err := time.ParseDuration(args[0])
+		if err != nil || wait <= 0 {
+			return fmt.Sprintf("Wait的参数必须是正的时长，如30s，实际为'%s'", args[0])
+		}
+		this.Wait = wait
+	case "Priority":
+		this.Priority = args
+	case "Path":
+		this.Path = args[0]
+	case "Infer":
+		this.Infer = true
+	case "Dir":
+		this.Dir = true
+	}
+	return ""
+}
+
+type tagParser struct {
+	s   string
+	pos int
+}
+
+func (this *tagParser) eof() bool {
+	return this.pos >= len(this.s)
+}
+
+func (this *tagParser) peek() byte {
+	return this.s[this.pos]
+}
+
+func (this *tagParser) skipSpace() {
+	for !this.eof() && isTagSpace(this.peek()) {
+		this.pos++
+	}
+}
+
+func (this *tagParser) ident() string {
+	start := this.pos
+	for !this.eof() {
+		c := rune(this.peek())
+		if c >= unicode.MaxASCII || !(unicode.IsLetter(c) || unicode.IsDigit(c) || c == '_') {
+			break
+		}
+		this.pos++
+	}
+	return this.s[start:this.pos]
+}
+
+// 解析`(...)`中以`|`分隔的参数
+func (this *tagParser) args() ([]string, error) {
+	open := this.pos
+	this.pos++
+	args := make([]string, 0, 1)
+	buf := make([]byte, 0, len(this.s)-this.pos)
+	// buf中需要保留的长度，用于去掉未引用的尾部空白
+	keep := 0
+	for {
+		if this.eof() {
+			return nil, this.errorf(open, this.pos, "缺少`)`")
+		}
+		c := this.peek()
+		switch {
+		case c == ')' || c == '|':
+			this.pos++
+			args = append(args, string(buf[:keep]))
+			buf, keep = buf[:0], 0
+			if c == ')' {
+				return args, nil
+			}
+		case c == '\\' && this.pos+1 < len(this.s) && isTagEscapable(this.s[this.pos+1]):
+			buf = append(buf, this.s[this.pos+1])
+			keep = len(buf)
+			this.pos += 2
+		case c == '\'' || c == '"':
+			quote := this.pos
+			end := strings.IndexByte(this.s[quote+1:], c)
+			if end < 0 {
+				return nil, this.errorf(quote, len(this.s), "引号没有闭合")
+			}
+			buf = append(buf, this.s[quote+1:quote+1+end]...)
+			keep = len(buf)
+			this.pos = quote + end + 2
+		case isTagSpace(c):
+			// 开头的空白直接忽略，中间的空白先保留
+			if len(buf) > 0 {
+				buf = append(buf, c)
+			}
+			this.pos++
+		default:
+			buf = append(buf, c)
+			keep = len(buf)
+			this.pos++
+		}
+	}
+}
+
+func (this *tagParser) errorf(start, end int, reason string) *TagError {
+	if end > len(this.s) {
+		end = len(this.s)
+	}
+	return &TagError{
+		Tag:      this.s,
+		Fragment: this.s[start:end],
+		Offset:   start,
+		Reason:   reason,
+	}
+}
+
+func isTagSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r'
+}
+
+// 转义tag参数中的特殊字符，parseTag的逆操作
+func quoteTagValue(s string) string {
+	buf := make([]byte, 0, len(s))
+	for i := 0; i < len(s); i++ {
+		if isTagEscapable(s[i]) {
+			buf = append(buf, '\\')
+		}
+		buf = append(buf, s[i])
+	}
+	return string(buf)
+}
+
+// tag参数中可以用`\`转义的字符
+func isTagEscapable(c byte) bool {
+	switch c {
+	case ';', '|', '(', ')', '\\', '\'', '"', ' ', '\t', '\n', '\r':
+		return true
+	}
+	return false
 }
 
 var defaultDirectoryTag = envTag{
@@ -99,3 +393,18 @@ var defaultFileTag = envTag{
 	Path:     "Path",
 	Priority: []string{},
 }
+
+// 校验tag是否合法，供代码生成时使用
+func validateTag(s string) error {
+	_, err := parseTag(s)
+	return err
+}
+
+func hasString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,83 @@
+package detector
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseTag(t *testing.T) {
+	et, err := parseTag(` Name( 'my db.conf' ) ; Priority(/run/conf|/mnt/my dir|/a\|b) ;Opt;Infer(); Key(DB_CONF);Ext(x\))`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	exp := envTag{
+		Name:     "my db.conf",
+		Key:      "DB_CONF",
+		Ext:      "x)",
+		Opt:      true,
+		Infer:    true,
+		Path:     "Path",
+		Priority: []string{"/run/conf", "/mnt/my dir", "/a|b"},
+	}
+	if !reflect.DeepEqual(et, exp) {
+		t.Errorf("预料之外的结果：%+v", et)
+	}
+
+	// 其他字符前的`\`按原样保留，如Windows的路径
+	et, err = parseTag(`Priority(C:\conf\app|D:\my\ dir\\)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exp := []string{`C:\conf\app`, `D:\my dir\`}; !reflect.DeepEqual(et.Priority, exp) {
+		t.Errorf("Windows的路径应该保留反斜杠：%q", et.Priority)
+	}
+
+	for _, v := range []string{"a b", "x;y|z(1)", `q'"\`} {
+		et, err := parseTag("Name(" + quoteTagValue(v) + ")")
+		if err != nil || et.Name != v {
+			t.Errorf("quoteTagValue(%q)无法还原：%q %v", v, et.Name, err)
+		}
+	}
+}
+
+func TestParseTagError(t *testing.T) {
+	cases := []struct {
+		tag      string
+		offset   int
+		fragment string
+	}{
+		{"Opt();Unknown(x)", 6, "Unknown(x)"},
+		{"Key(1ABC)", 0, "Key(1ABC)"},
+		{"Name(a", 4, "(a"},
+		{"Name('a)", 5, "'a)"},
+		{"Opt() x", 0, "Opt() x"},
+		{"Ext(a|b)", 0, "Ext(a|b)"},
+		{"Opt;Opt", 4, "Opt"},
+		{"Key(-|AB)", 0, "Key(-|AB)"},
+		{"Key(AB|AB)", 0, "Key(AB|AB)"},
+		{"Key(-);Deprecated(AB)", 0, "Key(-);Deprecated(AB)"},
+		{"Anchor(cwd)", 0, "Anchor(cwd)"},
+		{"Order(env|cwd)", 0, "Order(env|cwd)"},
+		{"Order(env|env)", 0, "Order(env|env)"},
+	}
+	for _, c := range cases {
+		_, err := parseTag(c.tag)
+		tagErr, ok := err.(*TagError)
+		if !ok {
+			t.Errorf("%s：应该返回TagError，实际为%v", c.tag, err)
+			continue
+		}
+		if tagErr.Offset != c.offset || tagErr.Fragment != c.fragment {
+			t.Errorf("%s：Exp(%d,%s)==Act(%d,%s)", c.tag, c.offset, c.fragment, tagErr.Offset, tagErr.Fragment)
+		}
+	}
+
+	err := NewDetector().Detect(&struct {
+		Conf struct {
+			DitFile string `pd:"Ext(txt);Split(-);Opt(x)"`
+		}
+	}{})
+	if tagErr, ok := err.(*TagError); !ok || tagErr.Field != "Conf.DitFile" {
+		t.Error("Detect应该返回带成员路径的TagError：", err)
+	}
+}
@@ -26,7 +26,7 @@ type Conf struct {
 	// 测试自定义的环境变量注入
 	DBConfigID string `pd:"Key(DB_CNF_ID);"`
 	// 测试带优先级的文件搜索
-	LogID string `pd:"Ext(file);Priority(/root/go/src/github.com/szyhf/go-path-detector/test/priority_test);"`
+	LogID string `pd:"Ext(file);Priority({base_dir}/priority_test);"`
 }
 
 type Runtimes struct {
@@ -54,7 +54,7 @@ func main() {
 	// log.SetFlags(// log.Ldate | // log.Ltime | // log.Llongfile)
 	// detector.SetLogger(os.Stdout, "[DEBUG]", log.Ldate|log.Ltime|log.Llongfile)
 
-	// 嵌套组合可以更快捷的优化组装
+	// 匿名成员会被展开，可以通过嵌套组合快捷地组装布局
 	work := &struct {
 		Work
 	}{}
@@ -64,7 +64,7 @@ func main() {
 		WithDirEnvKey("ENV_DIR") //.Debug(os.Stdout)
 	// WithFileSplit("-")
 	err := detector.
-		Detect(&work.Work)
+		Detect(work)
 	if err != nil {
 		data, _ := json.MarshalIndent(work, "", "\t")
 		log.Printf("%+v", string(data))
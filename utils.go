@@ -47,20 +47,6 @@ func dirExist(name string) bool {
 	return true
 }
 
-func fileJoin(elm ...string) string {
-	if p := filepath.Join(elm...); fileExist(p) {
-		return p
-	}
-	return ""
-}
-
-func dirJoin(elm ...string) string {
-	if p := filepath.Join(elm...); dirExist(p) {
-		return p
-	}
-	return ""
-}
-
 func dirJoinDbg(elm ...string) string {
 	if p := filepath.Join(elm...); dirExist(p) {
 		return p
@@ -166,3 +152,50 @@ func isValidateEnvKey(s string) bool {
 	// 因为环境变量键只支持字母、数字、下划线，且数字不能作为开头
 	return envKeyReg.MatchString(s)
 }
+
+// 根据字段名推断目录名
+func inferDirName(fieldName string, tag envTag, split string, parseType NameParseTypeID) string {
+	switch parseType {
+	case NameParseType.SmartSnake:
+		sl := nameSplit(fieldName)
+		if len(sl) > 0 {
+			if tag.Split != "" {
+				split = tag.Split
+			}
+			name := strings.Join(sl, split)
+			if tag.Ext != "" {
+				// 目录一般不要设Ext……
+				name = name + "." + tag.Ext
+			}
+			return strings.ToLower(name)
+		}
+	}
+	return fieldName
+}
+
+// 根据字段名推断文件名
+func inferFileName(fieldName string, tag envTag, split string, parseType NameParseTypeID) string {
+	switch parseType {
+	case NameParseType.SmartSnake:
+		sl := nameSplit(fieldName)
+		if len(sl) > 0 {
+			if tag.Split != "" {
+				split = tag.Split
+			}
+			name := strings.ToLower(strings.Join(sl, split))
+			if tag.Ext != "" {
+				// 扩展名总是用.做分隔符
+				name = name + "." + tag.Ext
+			}
+			return name
+		}
+	}
+	return fieldName
+}
+
+func joinFieldPath(parent, field string) string {
+	if parent == "" {
+		return field
+	}
+	return parent + "." + field
+}
@@ -0,0 +1,146 @@
+package detector
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	// 等待缺少的成员时，重试间隔从waitBackoffMin开始翻倍，直到waitBackoffMax
+	waitBackoffMin = 100 * time.Millisecond
+	waitBackoffMax = 2 * time.Second
+)
+
+// 一次探测调用的配置，尝试不同的工作目录时共享
+type detectCall struct {
+	ctx context.Context
+	// 开始探测的时间，Wait(...)从此时开始计算
+	start time.Time
+	// 等待所有缺少的必需成员，见DetectWait
+	waitAll bool
+	// waitAll时等待的截止时间，零值表示等待到ctx结束
+	waitUntil time.Time
+	// 不等待，需要等待的成员缺少时直接记为缺少，用于选择工作目录，见tryBaseDirs
+	noWait bool
+	// 目录列表的缓存
+	cache *DirCache
+	// 每次检查路径的超时，见WithProbeTimeout
+	probeTimeout time.Duration
+	// 所属Detector还没有返回的检查，见maxPendingProbes
+	pendingProbes chan struct{}
+}
+
+// 默认每次探测使用新的目录列表缓存，见WithDirCache
+func (this *detector) newCall(ctx context.Context) *detectCall {
+	cache := this.dirCache
+	if cache == nil {
+		cache = NewDirCache()
+	}
+	return &detectCall{
+		ctx:           ctx,
+		start:         time.Now(),
+		cache:         cache,
+		probeTimeout:  this.probeTimeout,
+		pendingProbes: this.pendingProbes,
+	}
+}
+
+// 目录、文件或者环境变量指向的路径不存在，等待时会重试
+type missingError struct {
+	msg string
+}
+
+func (this *missingError) Error() string {
+	return this.msg
+}
+
+func missingf(format string, args ...interface{}) error {
+	return &missingError{msg: fmt.Sprintf(format, args...)}
+}
+
+func isMissing(err error) bool {
+	_, ok := err.(*missingError)
+	return ok
+}
+
+func (this *detector) DetectWait(ctx context.Context, i interface{}, timeout time.Duration) error {
+	call := this.newCall(ctx)
+	call.waitAll = true
+	// 不使用context.WithTimeout，超时后仍然需要探测其他成员，才能列出所有缺少的成员
+	if timeout > 0 {
+		call.waitUntil = call.start.Add(timeout)
+	}
+	return this.detect(call, i)
+}
+
+// 成员缺少时是否需要等待，以及等待的截止时间，零值表示等待到ctx结束
+func (this *detectState) waitDeadline(step schemaStep, required bool) (time.Time, bool) {
+	if required && this.call.waitAll {
+		return this.call.waitUntil, true
+	}
+	if wait := step.tag().Wait; wait > 0 {
+		return this.call.start.Add(wait), true
+	}
+	return time.Time{}, false
+}
+
+// 以递增的间隔重新探测缺少的成员，直到出现、超时或者ctx结束，返回最后一次的结果
+func (this *Schema) waitStep(state *detectState, step schemaStep, deadline time.Time, err error) ([]string, error) {
+	backoff := waitBackoffMin
+	for {
+		wait := backoff
+		if !deadline.IsZero() {
+			if left := time.Until(deadline); left <= 0 {
+				return nil, err
+			} else if left < wait {
+				wait = left
+			}
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-state.call.ctx.Done():
+			timer.Stop()
+			return nil, err
+		case <-timer.C:
+		}
+
+		// 缓存的目录列表中没有缺少的成员，需要重新读取
+		state.call.cache.Invalidate()
+		paths, err2 := this.detectStep(state, step)
+		if err2 != nil && !isMissing(err2) && state.call.ctx.Err() != nil {
+			// 重试时ctx结束，仍然视为缺少
+			return nil, err
+		}
+		if err = err2; err == nil || !isMissing(err) {
+			return paths, err
+		}
+		if backoff *= 2; backoff > waitBackoffMax {
+			backoff = waitBackoffMax
+		}
+	}
+}
+
+// 等待结束后仍然缺少成员
+type waitMissingError struct {
+	// 缺少的成员数量
+	count int
+	msg   string
+}
+
+func (this *waitMissingError) Error() string {
+	return this.msg
+}
+
+// 等待结束后仍然缺少的成员
+func (this *Schema) waitError(missing []int, errs []error) error {
+	list := make([]string, 0, len(missing))
+	for i, id := range missing {
+		list = append(list, fmt.Sprintf("%s{%s}", this.steps[id].fieldPath(), errs[i].Error()))
+	}
+	return &waitMissingError{
+		count: len(missing),
+		msg:   fmt.Sprintf("等待结束时仍然缺少%d个成员：%s", len(missing), strings.Join(list, "；")),
+	}
+}
@@ -0,0 +1,151 @@
+package detector
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDetectWait(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	type layout struct {
+		Secrets struct {
+			TLSCrt string `pd:"Name(tls.crt)"`
+		}
+		Conf struct {
+			DBYaml string
+		}
+	}
+
+	// sidecar稍后写入
+	go func() {
+		time.Sleep(300 * time.Millisecond)
+		os.MkdirAll(filepath.Join(dir, "secrets"), 0755)
+		ioutil.WriteFile(filepath.Join(dir, "secrets", "tls.crt"), nil, 0644)
+	}()
+	os.MkdirAll(filepath.Join(dir, "conf"), 0755)
+	ioutil.WriteFile(filepath.Join(dir, "conf", "db.yaml"), nil, 0644)
+	var v layout
+	if err := NewDetector().WithDir(dir).DetectWait(context.Background(), &v, 5*time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if v.Secrets.TLSCrt != filepath.Join(dir, "secrets", "tls.crt") {
+		t.Error("应该等到文件出现：", v.Secrets.TLSCrt)
+	}
+
+	// 超时后列出所有缺少的成员
+	os.RemoveAll(filepath.Join(dir, "secrets"))
+	os.RemoveAll(filepath.Join(dir, "conf", "db.yaml"))
+	start := time.Now()
+	err = NewDetector().WithDir(dir).DetectWait(context.Background(), &layout{}, 300*time.Millisecond)
+	if err == nil {
+		t.Fatal("超时后应该报错")
+	}
+	if !strings.Contains(err.Error(), "Secrets{") || !strings.Contains(err.Error(), "Conf.DBYaml{") || strings.Contains(err.Error(), "Secrets.TLSCrt") {
+		t.Error("应该列出缺少的目录和文件，不包括目录下的成员：", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Error("应该在超时后立即返回：", elapsed)
+	}
+}
+
+func TestWaitTag(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	go func() {
+		time.Sleep(300 * time.Millisecond)
+		ioutil.WriteFile(filepath.Join(dir, "tls.crt"), nil, 0644)
+	}()
+	var v struct {
+		TLSCrt string `pd:"Name(tls.crt);Wait(5s)"`
+	}
+	if err := NewDetector().WithDir(dir).Detect(&v); err != nil {
+		t.Fatal(err)
+	}
+	if v.TLSCrt != filepath.Join(dir, "tls.crt") {
+		t.Error("Wait(...)应该等到文件出现：", v.TLSCrt)
+	}
+
+	// 其他错误不会等待
+	var v2 struct {
+		TLSCrt string `pd:"Name(${NOT_EXIST_VAR}.crt);Wait(5s)"`
+	}
+	start := time.Now()
+	if err := NewDetector().WithDir(dir).Detect(&v2); err == nil {
+		t.Error("未定义的变量应该报错")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Error("不是缺少文件的错误不应该等待：", elapsed)
+	}
+
+	if _, err := parseTag("Wait(soon)"); err == nil {
+		t.Error("Wait的参数必须是时长")
+	}
+}
+
+func TestDetectWaitBaseDir(t *testing.T) {
+	root, err := ioutil.TempDir("", "pd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	// 工作目录不对（如容器中的`/`），可执行文件所在的目录是对的
+	wd, app := filepath.Join(root, "wd"), filepath.Join(root, "app")
+	os.MkdirAll(wd, 0755)
+	os.MkdirAll(filepath.Join(app, "conf"), 0755)
+	ioutil.WriteFile(filepath.Join(app, "conf", "db.yaml"), nil, 0644)
+
+	oldWD, _ := os.Getwd()
+	defer os.Chdir(oldWD)
+	if err := os.Chdir(wd); err != nil {
+		t.Fatal(err)
+	}
+	oldArgs := os.Args
+	defer func() { os.Args = oldArgs }()
+	os.Args = append([]string{filepath.Join(app, "server")}, oldArgs[1:]...)
+
+	type layout struct {
+		Conf struct {
+			DBYaml string
+		}
+		TLSCrt string `pd:"Name(tls.crt)"`
+	}
+	go func() {
+		time.Sleep(300 * time.Millisecond)
+		ioutil.WriteFile(filepath.Join(app, "tls.crt"), nil, 0644)
+	}()
+	var v layout
+	start := time.Now()
+	if err := NewDetector().DetectWait(context.Background(), &v, 5*time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if v.TLSCrt != filepath.Join(app, "tls.crt") || v.Conf.DBYaml != filepath.Join(app, "conf", "db.yaml") {
+		t.Error("应该在可执行文件所在的目录下等待：", v)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Error("不应该在错误的工作目录下等待：", elapsed)
+	}
+
+	// 只由ctx限制时，报告选中的目录下缺少的成员
+	os.Remove(filepath.Join(app, "tls.crt"))
+	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancel()
+	err = NewDetector().DetectWait(ctx, &layout{}, 0)
+	if err == nil {
+		t.Fatal("超时后应该报错")
+	}
+	if !strings.Contains(err.Error(), "OSArgs[0]="+app) || !strings.Contains(err.Error(), "缺少1个成员") || !strings.Contains(err.Error(), "TLSCrt{") {
+		t.Error("应该列出可执行文件所在的目录下缺少的成员：", err)
+	}
+}
@@ -0,0 +1,249 @@
+package detector
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"time"
+)
+
+var ChangeKind = struct {
+	// 之前没有探测结果
+	Added string
+	// 现在没有探测结果
+	Removed string
+	// 探测结果指向了另一个路径
+	Moved string
+	// 路径不变，但符号链接指向的实际文件变了，如Kubernetes的ConfigMap、Secret通过`..data`整体替换
+	Updated string
+}{
+	Added:   "added",
+	Removed: "removed",
+	Moved:   "moved",
+	Updated: "updated",
+}
+
+// 一个成员的变化
+type FieldChange struct {
+	// 成员路径，形如`Conf.DBYaml`
+	Field string
+	// 见ChangeKind
+	Kind string
+	// 变化前后的路径，[]string成员使用os.PathListSeparator拼接
+	Old, New string
+}
+
+// 一次重新探测的结果
+type Change struct {
+	// 发生变化的成员，按定义顺序排列
+	Fields []FieldChange
+	// 重新探测出错时不为nil，此时结构体保持上次的结果
+	Err error
+}
+
+const (
+	// 默认的轮询间隔
+	defaultWatchInterval = 5 * time.Second
+	// 同一次替换会产生多个事件，收到事件后稍等片刻再一起处理
+	watchDebounce = 100 * time.Millisecond
+)
+
+// 监听时需要比较的探测结果
+type watchSnapshot struct {
+	// 每个成员的路径
+	paths []string
+	// 每个成员的路径解析符号链接后的实际路径
+	realPaths []string
+	// 需要监听的目录
+	dirs []string
+}
+
+// 检查路径时同样受到WithProbeTimeout的限制，无法访问的路径视为不存在
+func newWatchSnapshot(call *detectCall, targets []interface{}) watchSnapshot {
+	res := watchSnapshot{
+		paths:     make([]string, len(targets)),
+		realPaths: make([]string, len(targets)),
+	}
+	seen := make(map[string]bool)
+	addDir := func(dir string) {
+		if dir != "" && !seen[dir] {
+			seen[dir] = true
+			res.dirs = append(res.dirs, dir)
+		}
+	}
+	for i, target := range targets {
+		paths := targetPaths(target)
+		realPaths := make([]string, 0, len(paths))
+		for _, p := range paths {
+			real, _ := call.probe(p, func() (string, error) {
+				return filepath.EvalSymlinks(p)
+			})
+			realPaths = append(realPaths, real)
+			if ok, _ := call.dirExist(p); ok {
+				addDir(p)
+			}
+			// 文件及目录本身被替换时，变化发生在所在的目录
+			addDir(filepath.Dir(p))
+		}
+		res.paths[i] = strings.Join(paths, string(os.PathListSeparator))
+		res.realPaths[i] = strings.Join(realPaths, string(os.PathListSeparator))
+	}
+	return res
+}
+
+// 比较前后两次的探测结果
+func (this watchSnapshot) diff(fields []string, next watchSnapshot) []FieldChange {
+	res := make([]FieldChange, 0)
+	for i, field := range fields {
+		c := FieldChange{Field: field, Old: this.paths[i], New: next.paths[i]}
+		switch {
+		case c.Old == c.New:
+			if this.realPaths[i] == next.realPaths[i] {
+				continue
+			}
+			c.Kind = ChangeKind.Updated
+		case c.Old == "":
+			c.Kind = ChangeKind.Added
+		case c.New == "":
+			c.Kind = ChangeKind.Removed
+		default:
+			c.Kind = ChangeKind.Moved
+		}
+		res = append(res, c)
+	}
+	return res
+}
+
+// 监听目录变化的方式，见watch_linux.go
+type notifier interface {
+	// 替换需要监听的目录
+	watch(dirs []string) error
+	// 目录发生变化时会收到通知
+	events() <-chan struct{}
+	close() error
+}
+
+func (this *detector) Watch(ctx context.Context, i interface{}, onChange func(Change)) error {
+	t := reflect.TypeOf(i)
+	if t == nil || t.Kind() != reflect.Ptr {
+		return fmt.Errorf("%T不是Ptr", i)
+	}
+	sch, err := this.Compile(t)
+	if err != nil {
+		return err
+	}
+	v := reflect.ValueOf(i).Elem()
+	call := this.newCall(ctx)
+	if err := this.detectSchemas(call, boundSchema{sch: sch, targets: sch.bind(v)}); err != nil {
+		return err
+	}
+	fields := sch.targetFields()
+	last := newWatchSnapshot(call, sch.bind(v))
+
+	var n notifier
+	var events <-chan struct{}
+	if this.watchInotify {
+		if n, err = newNotifier(); err != nil {
+			this.logger.Println("[WARN]无法使用inotify，只使用轮询：" + err.Error())
+		} else {
+			defer n.close()
+			if err := n.watch(last.dirs); err != nil {
+				this.logger.Println("[WARN]监听目录出错：" + err.Error())
+			}
+			events = n.events()
+		}
+	}
+	interval := this.watchInterval
+	if interval <= 0 {
+		interval = defaultWatchInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	lastErr := ""
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		case <-events:
+			// 等待同一次修改的其他事件
+			timer := time.NewTimer(watchDebounce)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return ctx.Err()
+			case <-timer.C:
+			}
+			drainEvents(events)
+		}
+
+		// 探测到新的结构体中，出错时保持原来的结果
+		if this.dirCache != nil {
+			this.dirCache.Invalidate()
+		}
+		next := reflect.New(v.Type()).Elem()
+		targets := sch.bind(next)
+		call := this.newCall(ctx)
+		if err := this.detectSchemas(call, boundSchema{sch: sch, targets: targets}); err != nil {
+			if err.Error() != lastErr {
+				lastErr = err.Error()
+				onChange(Change{Err: err})
+			}
+			continue
+		}
+		lastErr = ""
+		snapshot := newWatchSnapshot(call, targets)
+		changes := last.diff(fields, snapshot)
+		last = snapshot
+		if n != nil {
+			if err := n.watch(snapshot.dirs); err != nil {
+				this.logger.Println("[WARN]监听目录出错：" + err.Error())
+			}
+		}
+		if len(changes) > 0 {
+			// 只更新路径，不影响结构体中的其他成员
+			copyTargets(sch.bind(v), targets)
+			onChange(Change{Fields: changes})
+		}
+	}
+}
+
+func copyTargets(dst, src []interface{}) {
+	for i := range dst {
+		switch target := dst[i].(type) {
+		case *string:
+			*target = *src[i].(*string)
+		case *[]string:
+			*target = *src[i].(*[]string)
+		}
+	}
+}
+
+func drainEvents(events <-chan struct{}) {
+	for {
+		select {
+		case <-events:
+		default:
+			return
+		}
+	}
+}
+
+// 按探测结果的顺序列出对应的成员路径
+func (this *Schema) targetFields() []string {
+	res := make([]string, this.numTargets)
+	for _, step := range this.steps {
+		if step.dir != nil {
+			if step.dir.pathTargetIdx >= 0 {
+				res[step.dir.pathTargetIdx] = joinFieldPath(step.dir.fieldPath(), step.dir.fieldTag.Path)
+			}
+		} else {
+			res[step.file.targetIdx] = step.fieldPath()
+		}
+	}
+	return res
+}
@@ -0,0 +1,89 @@
+//go:build linux
+
+package detector
+
+import (
+	"os"
+	"sync"
+	"syscall"
+)
+
+// 目录中的文件增删、改名、修改完成时都需要重新探测。
+// `..data`的替换表现为目录中的IN_MOVED_TO，所以只需要监听目录本身。
+const inotifyMask = syscall.IN_CREATE | syscall.IN_DELETE | syscall.IN_MOVED_FROM | syscall.IN_MOVED_TO |
+	syscall.IN_CLOSE_WRITE | syscall.IN_ATTRIB | syscall.IN_DELETE_SELF | syscall.IN_MOVE_SELF
+
+type inotifyNotifier struct {
+	mu   sync.Mutex
+	file *os.File
+	// 已经监听的目录
+	wds map[string]int
+	ch  chan struct{}
+}
+
+func newNotifier() (notifier, error) {
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if err != nil {
+		return nil, os.NewSyscallError("inotify_init1", err)
+	}
+	this := &inotifyNotifier{
+		// 非阻塞的fd会交给runtime的poller，Close时Read会立即返回
+		file: os.NewFile(uintptr(fd), "inotify"),
+		wds:  make(map[string]int),
+		ch:   make(chan struct{}, 1),
+	}
+	go this.readLoop()
+	return this, nil
+}
+
+func (this *inotifyNotifier) readLoop() {
+	buf := make([]byte, 64*(syscall.SizeofInotifyEvent+syscall.NAME_MAX+1))
+	for {
+		if _, err := this.file.Read(buf); err != nil {
+			return
+		}
+		// 只需要知道发生了变化，不需要解析具体的事件
+		select {
+		case this.ch <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (this *inotifyNotifier) watch(dirs []string) error {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	fd := int(this.file.Fd())
+	keep := make(map[string]bool, len(dirs))
+	var firstErr error
+	for _, dir := range dirs {
+		keep[dir] = true
+		if _, ok := this.wds[dir]; ok {
+			continue
+		}
+		wd, err := syscall.InotifyAddWatch(fd, dir, inotifyMask)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = &os.PathError{Op: "inotify_add_watch", Path: dir, Err: err}
+			}
+			continue
+		}
+		this.wds[dir] = wd
+	}
+	for dir, wd := range this.wds {
+		if !keep[dir] {
+			// 目录已经被删除时会自动移除，忽略错误
+			syscall.InotifyRmWatch(fd, uint32(wd))
+			delete(this.wds, dir)
+		}
+	}
+	return firstErr
+}
+
+func (this *inotifyNotifier) events() <-chan struct{} {
+	return this.ch
+}
+
+func (this *inotifyNotifier) close() error {
+	return this.file.Close()
+}
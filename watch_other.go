@@ -0,0 +1,9 @@
+//go:build !linux
+
+package detector
+
+import "errors"
+
+func newNotifier() (notifier, error) {
+	return nil, errors.New("当前系统不支持inotify")
+}
@@ -0,0 +1,98 @@
+package detector
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func waitChange(t *testing.T, ch <-chan Change) Change {
+	select {
+	case c := <-ch:
+		return c
+	case <-time.After(5 * time.Second):
+		t.Fatal("没有收到变化")
+	}
+	return Change{}
+}
+
+func testWatch(t *testing.T, det Detector, interval time.Duration) {
+	dir, err := ioutil.TempDir("", "pd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	// 模拟Kubernetes挂载的ConfigMap：conf/db.yaml -> ..data/db.yaml -> ..v1/db.yaml
+	conf := filepath.Join(dir, "conf")
+	os.MkdirAll(filepath.Join(conf, "..v1"), 0755)
+	ioutil.WriteFile(filepath.Join(conf, "..v1", "db.yaml"), nil, 0644)
+	os.Symlink("..v1", filepath.Join(conf, "..data"))
+	os.Symlink(filepath.Join("..data", "db.yaml"), filepath.Join(conf, "db.yaml"))
+
+	layout := &struct {
+		Conf struct {
+			DBYaml    string
+			RedisYaml string `pd:"Opt"`
+		}
+		Meta int `pd:"-"`
+	}{Meta: 1}
+	ch := make(chan Change, 10)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- det.WithWatchInterval(interval).WithDir(dir).Watch(ctx, layout, func(c Change) {
+			ch <- c
+		})
+	}()
+	time.Sleep(100 * time.Millisecond)
+
+	// 新增文件
+	ioutil.WriteFile(filepath.Join(conf, "redis.yaml"), nil, 0644)
+	c := waitChange(t, ch)
+	if len(c.Fields) != 1 || c.Fields[0].Field != "Conf.RedisYaml" || c.Fields[0].Kind != ChangeKind.Added {
+		t.Errorf("应该收到新增：%+v", c)
+	}
+
+	// `..data`整体替换
+	os.MkdirAll(filepath.Join(conf, "..v2"), 0755)
+	ioutil.WriteFile(filepath.Join(conf, "..v2", "db.yaml"), nil, 0644)
+	os.Symlink("..v2", filepath.Join(conf, "..data_tmp"))
+	os.Rename(filepath.Join(conf, "..data_tmp"), filepath.Join(conf, "..data"))
+	os.RemoveAll(filepath.Join(conf, "..v1"))
+	c = waitChange(t, ch)
+	if len(c.Fields) != 1 || c.Fields[0].Field != "Conf.DBYaml" || c.Fields[0].Kind != ChangeKind.Updated {
+		t.Errorf("应该收到更新：%+v", c)
+	}
+
+	// 删除文件
+	os.Remove(filepath.Join(conf, "redis.yaml"))
+	c = waitChange(t, ch)
+	if len(c.Fields) != 1 || c.Fields[0].Kind != ChangeKind.Removed || c.Fields[0].Old != filepath.Join(conf, "redis.yaml") {
+		t.Errorf("应该收到删除：%+v", c)
+	}
+
+	cancel()
+	if err := <-done; err != context.Canceled {
+		t.Error(err)
+	}
+	if layout.Conf.RedisYaml != "" || layout.Conf.DBYaml != filepath.Join(conf, "db.yaml") || layout.Meta != 1 {
+		t.Errorf("应该只更新路径：%+v", layout)
+	}
+}
+
+func TestWatchPolling(t *testing.T) {
+	testWatch(t, NewDetector(), 50*time.Millisecond)
+}
+
+func TestWatchInotify(t *testing.T) {
+	n, err := newNotifier()
+	if err != nil {
+		t.Skip(err)
+	}
+	n.close()
+	// 轮询间隔足够长，只能通过inotify收到变化
+	testWatch(t, NewDetector().WithInotify(), time.Hour)
+}